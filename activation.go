@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation
+const listenFDsStart = 3
+
+// InheritedSocket is a pre-opened socket passed by systemd or a supervisor process.
+// The socket file is owned by whoever created it, so the encryptor never unlinks it.
+type InheritedSocket struct {
+	Name       string // LISTEN_FDNAMES entry, or "fd<N>" for sockets without a name
+	Kind       string // "unix", "unix_stream", "udp" or "tcp"
+	Listener   net.Listener
+	PacketConn net.PacketConn
+	claimed    bool
+}
+
+// InheritedSockets holds sockets received through LISTEN_FDS until listeners claim them
+type InheritedSockets struct {
+	sockets []*InheritedSocket
+}
+
+// LoadInheritedSockets reads the systemd socket activation protocol (LISTEN_PID,
+// LISTEN_FDS, LISTEN_FDNAMES) and unsets it so child processes do not inherit it
+func LoadInheritedSockets() (*InheritedSockets, error) {
+	set := &InheritedSockets{}
+
+	fdsValue := os.Getenv("LISTEN_FDS")
+	if fdsValue == "" {
+		return set, nil
+	}
+	pidValue := os.Getenv("LISTEN_PID")
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	// The sockets are meant for another process (e.g. a wrapper script that did not exec)
+	if pidValue != "" && pidValue != strconv.Itoa(os.Getpid()) {
+		return set, nil
+	}
+
+	count, err := strconv.Atoi(fdsValue)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fdsValue)
+	}
+
+	for i := 0; i < count; i++ {
+		fd := listenFDsStart + i
+		name := fmt.Sprintf("fd%d", fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		socket, err := newInheritedSocket(fd, name)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Inherited %s socket %q (fd %d)", socket.Kind, socket.Name, fd)
+		set.sockets = append(set.sockets, socket)
+	}
+	return set, nil
+}
+
+// newInheritedSocket wraps a file descriptor, detecting its socket type
+func newInheritedSocket(fd int, name string) (*InheritedSocket, error) {
+	file := os.NewFile(uintptr(fd), name)
+	if file == nil {
+		return nil, fmt.Errorf("invalid inherited file descriptor %d", fd)
+	}
+	// net.File* duplicate the descriptor (close-on-exec), so the original is always closed
+	defer file.Close()
+
+	socket := &InheritedSocket{Name: name}
+	// FileListener also accepts unix datagram sockets, so check the address network
+	if listener, err := net.FileListener(file); err == nil {
+		switch listener.Addr().Network() {
+		case "tcp":
+			socket.Kind = "tcp"
+			socket.Listener = listener
+			return socket, nil
+		case "unix":
+			socket.Kind = "unix_stream"
+			listener.(*net.UnixListener).SetUnlinkOnClose(false)
+			socket.Listener = listener
+			return socket, nil
+		}
+		listener.Close()
+	}
+
+	conn, err := net.FilePacketConn(file)
+	if err != nil {
+		return nil, fmt.Errorf("inherited fd %d (%q) is not a supported socket: %w", fd, name, err)
+	}
+	switch conn.(type) {
+	case *net.UDPConn:
+		socket.Kind = "udp"
+	case *net.UnixConn:
+		socket.Kind = "unix"
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("unsupported inherited packet socket %q (fd %d)", name, fd)
+	}
+	socket.PacketConn = conn
+	return socket, nil
+}
+
+// Claim returns the inherited socket for a listener, selected by fdName (a LISTEN_FDNAMES
+// entry), fd (a plain inherited descriptor, -1 for none), or else the first unclaimed
+// activated socket of the same kind when autoClaim is set.
+// Returns nil when the listener has no inherited socket.
+func (set *InheritedSockets) Claim(fdName string, fd int, kind string, autoClaim bool) (*InheritedSocket, error) {
+	var socket *InheritedSocket
+
+	if name := fdName; name != "" {
+		for _, s := range set.sockets {
+			if s.Name == name && !s.claimed {
+				socket = s
+				break
+			}
+		}
+		if socket == nil {
+			return nil, fmt.Errorf("no unclaimed activated socket named %q", name)
+		}
+	} else if fd >= 0 {
+		var err error
+		if socket, err = newInheritedSocket(fd, fmt.Sprintf("fd%d", fd)); err != nil {
+			return nil, err
+		}
+		set.sockets = append(set.sockets, socket)
+	} else if autoClaim {
+		for _, s := range set.sockets {
+			if s.Kind == kind && !s.claimed {
+				socket = s
+				break
+			}
+		}
+	}
+
+	if socket == nil {
+		return nil, nil
+	}
+	if socket.Kind != kind {
+		return nil, fmt.Errorf("inherited socket %q is %s, but the listener needs %s", socket.Name, socket.Kind, kind)
+	}
+	socket.claimed = true
+	return socket, nil
+}
+
+// CloseUnclaimed closes activated sockets that no listener is configured to use
+func (set *InheritedSockets) CloseUnclaimed() {
+	for _, s := range set.sockets {
+		if s.claimed {
+			continue
+		}
+		log.Printf("Warning: inherited %s socket %q is not used by any listener", s.Kind, s.Name)
+		if s.Listener != nil {
+			s.Listener.Close()
+		}
+		if s.PacketConn != nil {
+			s.PacketConn.Close()
+		}
+	}
+}
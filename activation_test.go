@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// activatedUnixSockets opens datagram sockets as if passed through LISTEN_FDS
+func activatedUnixSockets(t *testing.T, names ...string) *InheritedSockets {
+	t.Helper()
+	set := &InheritedSockets{}
+	for _, name := range names {
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(t.TempDir(), name), Net: "unixgram"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		set.sockets = append(set.sockets, &InheritedSocket{Name: name, Kind: "unix", PacketConn: conn})
+	}
+	return set
+}
+
+func TestResolveListenersSeveralSocketsOfOneKind(t *testing.T) {
+	for _, variable := range []string{"SOCKET_PATH", "SOCKET_FDNAME", "SOCKET_FD", "JOURNAL_SOCKET_PATH"} {
+		t.Setenv(variable, "")
+	}
+
+	tests := []struct {
+		name      string
+		listeners string
+		sockets   []string
+		want      map[string]string // Listener name to socket name
+	}{
+		{
+			name:      "listeners take sockets in order",
+			listeners: `[{"name":"app1","type":"unix"},{"name":"app2","type":"unix"}]`,
+			sockets:   []string{"a", "b"},
+			want:      map[string]string{"app1": "a", "app2": "b"},
+		},
+		{
+			name:      "single-listener socket takes the remaining socket",
+			listeners: `[{"name":"app1","type":"unix"},{"name":"app2","type":"unix"}]`,
+			sockets:   []string{"a", "b", "c"},
+			want:      map[string]string{"app1": "a", "app2": "b", "unix": "c"},
+		},
+		{
+			name:      "named socket is reserved for its listener",
+			listeners: `[{"name":"app1","type":"unix"},{"name":"app2","type":"unix","fd_name":"a"}]`,
+			sockets:   []string{"a", "b"},
+			want:      map[string]string{"app1": "b", "app2": "a"},
+		},
+		{
+			name:    "single-listener socket without LISTENERS",
+			sockets: []string{"a"},
+			want:    map[string]string{"unix": "a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configs, err := LoadListenerConfigs(tt.listeners)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resolved, err := ResolveListeners(configs, activatedUnixSockets(t, tt.sockets...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for _, cfg := range resolved {
+				if cfg.inherited != nil {
+					got[cfg.Name] = cfg.inherited.Name
+				}
+			}
+			if len(got) != len(tt.want) || len(resolved) != len(tt.want) {
+				t.Fatalf("resolved %v, want %v", got, tt.want)
+			}
+			for listener, socket := range tt.want {
+				if got[listener] != socket {
+					t.Errorf("listener %s got socket %q, want %q", listener, got[listener], socket)
+				}
+			}
+		})
+	}
+}
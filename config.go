@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Note: These helpers crash on invalid values intentionally - fail fast on startup
+// for misconfiguration rather than running with unexpected limits
+
+// getEnvInt returns an integer environment variable or def when unset
+func getEnvInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatalf("Invalid %s: must be a non-negative integer", name)
+	}
+	return n
+}
+
+// getEnvBool returns a boolean environment variable ("true", "1", "false", "0", ...) or def when unset
+func getEnvBool(name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: must be true or false", name)
+	}
+	return b
+}
+
+// getEnvDuration returns a duration environment variable (e.g. "30s", "5m") or def when unset
+func getEnvDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Fatalf("Invalid %s: must be a non-negative duration (e.g. 30s, 5m)", name)
+	}
+	return d
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Credentials identify the process that sent a datagram, as reported by the kernel
+type Credentials struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// Metadata returns the credentials as envelope attributes, optionally resolving
+// the sender's executable from /proc (like journald's _EXE field)
+func (c *Credentials) Metadata(withExe bool) Metadata {
+	meta := Metadata{
+		"pid": strconv.FormatInt(int64(c.PID), 10),
+		"uid": strconv.FormatUint(uint64(c.UID), 10),
+		"gid": strconv.FormatUint(uint64(c.GID), 10),
+	}
+	if withExe && c.PID > 0 {
+		// The sender may already have exited; the path is best-effort
+		if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", c.PID)); err == nil {
+			meta["exe"] = exe
+		}
+	}
+	return meta
+}
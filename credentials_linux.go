@@ -0,0 +1,52 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// credentialsSupported reports whether SCM_CREDENTIALS can be captured on this platform
+const credentialsSupported = true
+
+// credentialsOOBSize is the ancillary buffer size needed for one SCM_CREDENTIALS message
+var credentialsOOBSize = syscall.CmsgSpace(syscall.SizeofUcred)
+
+// enablePassCred sets SO_PASSCRED so the kernel attaches sender credentials to every datagram
+func enablePassCred(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+	}); err != nil {
+		return err
+	}
+	if sockErr != nil {
+		return fmt.Errorf("setsockopt SO_PASSCRED: %w", sockErr)
+	}
+	return nil
+}
+
+// parseCredentials extracts SCM_CREDENTIALS from a datagram's ancillary data
+func parseCredentials(oob []byte) (*Credentials, bool) {
+	messages, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, false
+	}
+	for i := range messages {
+		if messages[i].Header.Level != syscall.SOL_SOCKET || messages[i].Header.Type != syscall.SCM_CREDENTIALS {
+			continue
+		}
+		ucred, err := syscall.ParseUnixCredentials(&messages[i])
+		if err != nil {
+			return nil, false
+		}
+		return &Credentials{PID: ucred.Pid, UID: ucred.Uid, GID: ucred.Gid}, true
+	}
+	return nil, false
+}
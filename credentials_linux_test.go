@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestParseCredentials(t *testing.T) {
+	ucred := &syscall.Ucred{Pid: 4242, Uid: 1000, Gid: 100}
+	creds, ok := parseCredentials(syscall.UnixCredentials(ucred))
+	if !ok || *creds != (Credentials{PID: 4242, UID: 1000, GID: 100}) {
+		t.Errorf("parseCredentials = %+v, %v, want %+v", creds, ok, ucred)
+	}
+
+	// Datagrams without SCM_CREDENTIALS carry no identity
+	for _, oob := range [][]byte{nil, syscall.UnixRights(0), {1, 2, 3}} {
+		if creds, ok := parseCredentials(oob); ok {
+			t.Errorf("parseCredentials(%v) = %+v, want none", oob, creds)
+		}
+	}
+}
+
+func TestUnixSyslogServerCredentials(t *testing.T) {
+	router, path := testRouter(t)
+	client := serveUnixgram(t, router, UnixSocketConfig{Permissions: SocketPermissions{Mode: 0o666, UID: -1, GID: -1}, Credentials: true, CredentialsExe: true})
+	if _, err := client.Write([]byte("<134>Oct 18 10:00:00 host app: hello\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The kernel reports this process as the sender
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Metadata{
+		"pid": strconv.Itoa(os.Getpid()),
+		"uid": strconv.Itoa(os.Getuid()),
+		"gid": strconv.Itoa(os.Getgid()),
+		"exe": exe,
+	}
+	record := waitRecords(t, router, path, 1)[0]
+	if record.Message != "<134>Oct 18 10:00:00 host app: hello" {
+		t.Errorf("record = %q", record.Message)
+	}
+	for key, value := range want {
+		if record.Metadata[key] != value {
+			t.Errorf("metadata %s = %q, want %q", key, record.Metadata[key], value)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+// credentialsSupported reports whether SCM_CREDENTIALS can be captured on this platform
+const credentialsSupported = false
+
+// credentialsOOBSize is zero because no ancillary data is requested
+var credentialsOOBSize = 0
+
+// enablePassCred is only implemented on Linux
+func enablePassCred(conn *net.UnixConn) error {
+	return fmt.Errorf("SO_PASSCRED is only supported on Linux")
+}
+
+// parseCredentials never finds credentials outside Linux
+func parseCredentials(oob []byte) (*Credentials, bool) {
+	return nil, false
+}
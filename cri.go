@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// criPodLogPaths are the container log files the kubelet writes on every node
+const criPodLogPaths = "/var/log/pods/*/*/*.log"
+
+// criLine is one line of a CRI container log: "<RFC3339Nano time> <stream> <tag> <content>"
+type criLine struct {
+	time    time.Time
+	stream  string // "stdout" or "stderr"
+	partial bool   // The runtime split a long line; the content continues on the next line
+	content []byte
+}
+
+// parseCRILine splits a CRI log line. The tag is "P" for partial and "F" for full lines,
+// optionally followed by further colon-separated flags.
+func parseCRILine(line []byte) (criLine, error) {
+	fields := bytes.SplitN(line, []byte{' '}, 4)
+	if len(fields) < 3 {
+		return criLine{}, fmt.Errorf("invalid CRI log line")
+	}
+	logged, err := time.Parse(time.RFC3339Nano, string(fields[0]))
+	if err != nil {
+		return criLine{}, fmt.Errorf("invalid CRI timestamp %q", fields[0])
+	}
+	stream := string(fields[1])
+	if stream != "stdout" && stream != "stderr" {
+		return criLine{}, fmt.Errorf("invalid CRI stream %q", stream)
+	}
+	tag, _, _ := strings.Cut(string(fields[2]), ":")
+	if tag != "P" && tag != "F" {
+		return criLine{}, fmt.Errorf("invalid CRI tag %q", fields[2])
+	}
+
+	parsed := criLine{time: logged, stream: stream, partial: tag == "P"}
+	if len(fields) == 4 {
+		parsed.content = fields[3]
+	}
+	return parsed, nil
+}
+
+// criPodMetadata returns the namespace, pod and container names encoded in a kubelet log
+// path, /var/log/pods/<namespace>_<pod>_<uid>/<container>/<restart>.log. Namespace and pod
+// names cannot contain underscores, so the directory name splits unambiguously.
+func criPodMetadata(path string) Metadata {
+	containerDir := filepath.Dir(path)
+	podDir := filepath.Base(filepath.Dir(containerDir))
+	meta := Metadata{"container": filepath.Base(containerDir)}
+	if parts := strings.SplitN(podDir, "_", 3); len(parts) == 3 {
+		meta["namespace"] = parts[0]
+		meta["pod"] = parts[1]
+	}
+	return meta
+}
+
+// criReassembler rejoins the partial lines of a container log file. stdout and stderr are
+// written to the same file, so each stream is rejoined separately.
+type criReassembler struct {
+	listener string
+	limit    MessageLimit
+	partial  map[string][]byte    // By stream
+	started  map[string]time.Time // Time of each stream's first partial line
+}
+
+func newCRIReassembler(listener string, limit MessageLimit) *criReassembler {
+	return &criReassembler{
+		listener: listener,
+		limit:    limit,
+		partial:  make(map[string][]byte),
+		started:  make(map[string]time.Time),
+	}
+}
+
+// Add processes one line and returns the stream, the time the runtime logged the first
+// part of the line, and the records it completes, split or truncated according to the
+// message limit
+func (c *criReassembler) Add(line []byte) (string, time.Time, [][]byte, error) {
+	parsed, err := parseCRILine(line)
+	if err != nil {
+		return "", time.Time{}, nil, err
+	}
+	logged, ok := c.started[parsed.stream]
+	if !ok {
+		logged = parsed.time
+	}
+	data := append(c.partial[parsed.stream], parsed.content...)
+
+	if !parsed.partial {
+		delete(c.partial, parsed.stream)
+		delete(c.started, parsed.stream)
+		if len(data) == 0 {
+			return parsed.stream, logged, nil, nil
+		}
+		return parsed.stream, logged, c.limit.Apply(c.listener, data), nil
+	}
+
+	// Bound the held record: split emits complete parts early, the other policies only
+	// need to know that the record is too long
+	var records [][]byte
+	if max := c.limit.MaxSize; max > 0 && len(data) > max {
+		if c.limit.Policy == SizePolicySplit {
+			cut := len(data) - len(data)%max
+			records = c.limit.Apply(c.listener, data[:cut])
+			data = append([]byte(nil), data[cut:]...)
+		} else {
+			data = data[:max+1]
+		}
+	}
+	c.partial[parsed.stream] = data
+	c.started[parsed.stream] = logged
+	return parsed.stream, logged, records, nil
+}
+
+// Pending reports whether a partial line is held, in which case the file offset must
+// not be checkpointed past its first part
+func (c *criReassembler) Pending() bool {
+	return len(c.partial) > 0
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCRILine(t *testing.T) {
+	tests := []struct {
+		line    string
+		time    string // RFC3339Nano, empty for invalid lines
+		stream  string
+		partial bool
+		content string
+	}{
+		{"2024-05-02T10:00:00.123456789Z stdout F hello world", "2024-05-02T10:00:00.123456789Z", "stdout", false, "hello world"},
+		{"2024-05-02T12:00:00.5+02:00 stderr P part", "2024-05-02T12:00:00.5+02:00", "stderr", true, "part"},
+		{"2024-05-02T10:00:00Z stdout F:x", "2024-05-02T10:00:00Z", "stdout", false, ""},
+		{"2024-05-02 stdout F hello", "", "", false, ""},
+		{"yesterday stdout F hello", "", "", false, ""},
+		{"2024-05-02T10:00:00Z stdin F hello", "", "", false, ""},
+		{"2024-05-02T10:00:00Z stdout X hello", "", "", false, ""},
+		{"2024-05-02T10:00:00Z stdout", "", "", false, ""},
+	}
+	for _, tt := range tests {
+		parsed, err := parseCRILine([]byte(tt.line))
+		if tt.time == "" {
+			if err == nil {
+				t.Errorf("parseCRILine(%q) succeeded, want error", tt.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCRILine(%q): %v", tt.line, err)
+			continue
+		}
+		want, _ := time.Parse(time.RFC3339Nano, tt.time)
+		if !parsed.time.Equal(want) || parsed.time.Format(time.RFC3339Nano) != tt.time {
+			t.Errorf("parseCRILine(%q) time = %s, want %s", tt.line, parsed.time.Format(time.RFC3339Nano), tt.time)
+		}
+		if parsed.stream != tt.stream || parsed.partial != tt.partial || string(parsed.content) != tt.content {
+			t.Errorf("parseCRILine(%q) = %s %v %q, want %s %v %q", tt.line, parsed.stream, parsed.partial, parsed.content, tt.stream, tt.partial, tt.content)
+		}
+	}
+}
+
+func TestCRIReassemblerTime(t *testing.T) {
+	steps := []struct {
+		line    string
+		stream  string
+		time    string // Time of the returned records
+		records []string
+	}{
+		{"2024-05-02T10:00:01Z stdout P first ", "stdout", "2024-05-02T10:00:01Z", nil},
+		{"2024-05-02T10:00:02Z stderr F error", "stderr", "2024-05-02T10:00:02Z", []string{"error"}},
+		{"2024-05-02T10:00:03Z stdout P second ", "stdout", "2024-05-02T10:00:01Z", nil},
+		{"2024-05-02T10:00:04Z stdout F third", "stdout", "2024-05-02T10:00:01Z", []string{"first second third"}},
+		{"2024-05-02T10:00:05Z stdout F next", "stdout", "2024-05-02T10:00:05Z", []string{"next"}},
+	}
+	c := newCRIReassembler("test", MessageLimit{})
+	for _, step := range steps {
+		stream, logged, records, err := c.Add([]byte(step.line))
+		if err != nil {
+			t.Fatalf("Add(%q): %v", step.line, err)
+		}
+		if stream != step.stream || logged.Format(time.RFC3339) != step.time {
+			t.Errorf("Add(%q) = %s at %s, want %s at %s", step.line, stream, logged.Format(time.RFC3339), step.stream, step.time)
+		}
+		if len(records) != len(step.records) {
+			t.Fatalf("Add(%q) records = %q, want %q", step.line, records, step.records)
+		}
+		for i, record := range records {
+			if string(record) != step.records[i] {
+				t.Errorf("Add(%q) record %d = %q, want %q", step.line, i, record, step.records[i])
+			}
+		}
+	}
+	if c.Pending() {
+		t.Error("partial line still pending after its full line")
+	}
+}
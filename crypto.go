@@ -57,21 +57,35 @@ type EncryptResult struct {
 	EncryptedData string
 }
 
-func (e *Encryptor) Encrypt(plaintext string) (*EncryptResult, error) {
+// Encrypt seals plaintext with a random nonce. additionalData is authenticated but not
+// encrypted; the decryptor must supply the same bytes to open the message.
+func (e *Encryptor) Encrypt(plaintext string, additionalData []byte) (*EncryptResult, error) {
+	nonce := make([]byte, NonceSize)
+	ciphertext, err := e.Seal(nil, nonce, []byte(plaintext), additionalData)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptResult{
+		Nonce:         base64.StdEncoding.EncodeToString(nonce),
+		EncryptedData: base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// NonceSize is the AES-GCM nonce length in bytes
+const NonceSize = 12
+
+// Seal fills nonce (NonceSize bytes) with random data and appends the ciphertext of
+// plaintext to dst. It is the allocation-free form of Encrypt for the output path.
+func (e *Encryptor) Seal(dst, nonce, plaintext, additionalData []byte) ([]byte, error) {
 	if e.gcm == nil {
 		return nil, fmt.Errorf("encryptor not initialized with shared secret")
 	}
 
-	nonce := make([]byte, e.gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return nil, fmt.Errorf("failed to generate nonce: %w", err)
 	}
 
-	ciphertext := e.gcm.Seal(nil, nonce, []byte(plaintext), nil)
-	return &EncryptResult{
-		Nonce:         base64.StdEncoding.EncodeToString(nonce),
-		EncryptedData: base64.StdEncoding.EncodeToString(ciphertext),
-	}, nil
+	return e.gcm.Seal(dst, nonce, plaintext, additionalData), nil
 }
 
 func (e *Encryptor) GetPublicKey() [32]byte {
@@ -50,7 +50,8 @@ func (d *Decryptor) SetupSharedSecret(peerPublicKey [32]byte) error {
 	return nil
 }
 
-func (d *Decryptor) Decrypt(nonce, encryptedData string) (string, error) {
+// Decrypt opens a message; additionalData must match the metadata authenticated by the encryptor
+func (d *Decryptor) Decrypt(nonce, encryptedData string, additionalData []byte) (string, error) {
 	if d.gcm == nil {
 		return "", fmt.Errorf("decryptor not initialized with shared secret")
 	}
@@ -68,7 +69,7 @@ func (d *Decryptor) Decrypt(nonce, encryptedData string) (string, error) {
 	}
 
 	// Decrypt
-	plaintext, err := d.gcm.Open(nil, nonceBytes, ciphertext, nil)
+	plaintext, err := d.gcm.Open(nil, nonceBytes, ciphertext, additionalData)
 	if err != nil {
 		return "", fmt.Errorf("failed to decrypt: %w", err)
 	}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// recordAdditionalData rebuilds the data authenticated with a record's ciphertext: the
+// canonical metadata, or {"a":..,"h":..} when the record carries labels
+func recordAdditionalData(entry *EncryptedLogEntry) ([]byte, error) {
+	var attributes []byte
+	if len(entry.Attributes) > 0 {
+		attributes, _ = json.Marshal(entry.Attributes)
+	}
+	if len(entry.Labels) == 0 {
+		return attributes, nil
+	}
+
+	// Labels are either a clear text object or an encrypted base64 string
+	var labels []byte
+	var encrypted string
+	if err := json.Unmarshal(entry.Labels, &encrypted); err == nil {
+		labels, _ = json.Marshal(encrypted)
+	} else {
+		var values map[string]string
+		if err := json.Unmarshal(entry.Labels, &values); err != nil {
+			return nil, fmt.Errorf("invalid labels: %w", err)
+		}
+		labels, _ = json.Marshal(values)
+	}
+
+	data := []byte{'{'}
+	if attributes != nil {
+		data = append(data, `"a":`...)
+		data = append(data, attributes...)
+		data = append(data, ',')
+	}
+	data = append(data, `"h":`...)
+	data = append(data, labels...)
+	return append(data, '}'), nil
+}
+
+// DecryptLabels returns the labels of a record, decrypting them if necessary.
+// Encrypted labels are the base64 of nonce and ciphertext.
+func (d *Decryptor) DecryptLabels(raw json.RawMessage) (map[string]string, error) {
+	var labels map[string]string
+	var encrypted string
+	if err := json.Unmarshal(raw, &encrypted); err != nil {
+		if err := json.Unmarshal(raw, &labels); err != nil {
+			return nil, fmt.Errorf("invalid labels: %w", err)
+		}
+		return labels, nil
+	}
+
+	if d.gcm == nil {
+		return nil, fmt.Errorf("decryptor not initialized with shared secret")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode labels: %w", err)
+	}
+	if len(sealed) < d.gcm.NonceSize() {
+		return nil, fmt.Errorf("encrypted labels too short")
+	}
+	plaintext, err := d.gcm.Open(nil, sealed[:d.gcm.NonceSize()], sealed[d.gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt labels: %w", err)
+	}
+	if err := json.Unmarshal(plaintext, &labels); err != nil {
+		return nil, fmt.Errorf("invalid labels: %w", err)
+	}
+	return labels, nil
+}
+
+// formatLabels renders labels as "[name=value ...] " in name order
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + labels[name]
+	}
+	return "[" + strings.Join(pairs, " ") + "] "
+}
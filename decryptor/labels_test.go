@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// testDecryptor opens the records in testdata, which the encryptor's tests encrypted to
+// their own public key with the private key 01 00 .. 00
+func testDecryptor(t *testing.T) *Decryptor {
+	t.Helper()
+	var privateKey [32]byte
+	privateKey[0] = 1
+	decryptor, err := NewDecryptor(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decryptor.SetupSharedSecret(decryptor.GetPublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	return decryptor
+}
+
+// readTestRecords returns the records of testdata/labels.jsonl
+func readTestRecords(t *testing.T) []EncryptedLogEntry {
+	t.Helper()
+	f, err := os.Open("testdata/labels.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var entries []EncryptedLogEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry EncryptedLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestRecordAdditionalData(t *testing.T) {
+	decryptor := testDecryptor(t)
+	want := []struct {
+		message string
+		labels  map[string]string
+	}{
+		{"labels without metadata", map[string]string{"cluster": "prod", "zone": "eu-1"}},
+		{"labels with metadata", map[string]string{"cluster": "prod"}},
+		{"encrypted labels", map[string]string{"cluster": "prod"}},
+		{"labels needing escapes", map[string]string{"zone": "<eu & us>", "site": "Zürich"}},
+		{"metadata without labels", nil},
+	}
+	entries := readTestRecords(t)
+	if len(entries) != len(want) {
+		t.Fatalf("got %d test records, want %d", len(entries), len(want))
+	}
+
+	for i, entry := range entries {
+		additionalData, err := recordAdditionalData(&entry)
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		message, err := decryptor.Decrypt(entry.Nonce, entry.EncryptedData, additionalData)
+		if err != nil {
+			t.Errorf("record %d: %v (additional data %s)", i, err, additionalData)
+			continue
+		}
+		if message != want[i].message {
+			t.Errorf("record %d = %q, want %q", i, message, want[i].message)
+		}
+		if len(entry.Labels) == 0 {
+			continue
+		}
+		labels, err := decryptor.DecryptLabels(entry.Labels)
+		if err != nil || !reflect.DeepEqual(labels, want[i].labels) {
+			t.Errorf("record %d labels = %v, %v, want %v", i, labels, err, want[i].labels)
+		}
+	}
+}
+
+func TestRecordAdditionalDataTampered(t *testing.T) {
+	decryptor := testDecryptor(t)
+	entries := readTestRecords(t)
+	clear, encrypted, unlabeled := entries[1], entries[2], entries[4]
+
+	tests := []struct {
+		name   string
+		entry  EncryptedLogEntry
+		tamper func(*EncryptedLogEntry)
+	}{
+		{"changed label value", clear, func(e *EncryptedLogEntry) { e.Labels = json.RawMessage(`{"cluster":"dev"}`) }},
+		{"removed labels", clear, func(e *EncryptedLogEntry) { e.Labels = nil }},
+		{"labels added", unlabeled, func(e *EncryptedLogEntry) { e.Labels = json.RawMessage(`{"cluster":"prod"}`) }},
+		{"encrypted labels made clear", encrypted, func(e *EncryptedLogEntry) { e.Labels = json.RawMessage(`{"cluster":"prod"}`) }},
+		{"encrypted labels swapped", encrypted, func(e *EncryptedLogEntry) { e.Labels = entries[0].Labels }},
+		{"changed metadata", clear, func(e *EncryptedLogEntry) { e.Attributes = map[string]string{"pid": "1", "uid": "0"} }},
+	}
+	for _, tt := range tests {
+		entry := tt.entry
+		tt.tamper(&entry)
+		additionalData, err := recordAdditionalData(&entry)
+		if err != nil {
+			continue
+		}
+		if _, err := decryptor.Decrypt(entry.Nonce, entry.EncryptedData, additionalData); err == nil {
+			t.Errorf("%s: tampered record decrypted", tt.name)
+		}
+	}
+}
@@ -7,12 +7,23 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"time"
 )
 
+// maxRecordSize bounds the length of one record line
+const maxRecordSize = 1 << 30
+
 type EncryptedLogEntry struct {
-	Timestamp     string `json:"t"`
-	Nonce         string `json:"n"`
-	EncryptedData string `json:"m"`
+	Timestamp     string            `json:"t"`
+	OriginalTime  string            `json:"o,omitempty"`
+	OriginalZone  string            `json:"z,omitempty"`
+	Nonce         string            `json:"n"`
+	EncryptedData string            `json:"m"`
+	Route         string            `json:"r,omitempty"`
+	Listener      string            `json:"l,omitempty"`
+	Attributes    map[string]string `json:"a,omitempty"`
+	Labels        json.RawMessage   `json:"h,omitempty"`
 }
 
 func main() {
@@ -48,6 +59,24 @@ func main() {
 		log.Fatalf("ENCRYPTOR_PUBLIC_KEY must be exactly 32 bytes (64 hex characters)")
 	}
 
+	// Optional route filter: only decrypt records encrypted for this route
+	// (use "default" for records without a route)
+	routeFilter, routeFilterSet := os.LookupEnv("ROUTE")
+
+	// Optional listener filter: only decrypt records received by this listener
+	listenerFilter := os.Getenv("LISTENER")
+
+	// Optional time window and ordering on the receive or original timestamp
+	timeFilter, err := NewTimeFilterFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid time filter: %v", err)
+	}
+	sortOutput := os.Getenv("SORT") != ""
+
+	// Optionally prefix each message with the labels of its record
+	showLabels := os.Getenv("SHOW_LABELS") != ""
+	var sorted []decryptedRecord
+
 	var encryptorPublicKey [32]byte
 	copy(encryptorPublicKey[:], encryptorPublicKeyBytes)
 
@@ -69,6 +98,8 @@ func main() {
 
 	// Process stdin line by line
 	scanner := bufio.NewScanner(os.Stdin)
+	// Records of unlimited messages (e.g. STDIN_FRAMING=whole) exceed the default 64 KB line
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
 	for scanner.Scan() {
 		line := scanner.Text()
 		
@@ -84,13 +115,45 @@ func main() {
 			continue
 		}
 
+		if routeFilterSet && !matchesRoute(entry.Route, routeFilter) {
+			continue
+		}
+		if listenerFilter != "" && entry.Listener != listenerFilter {
+			continue
+		}
+		if !timeFilter.Match(&entry) {
+			continue
+		}
+
+		// Metadata and labels are authenticated as additional data in their canonical (sorted key) form
+		additionalData, err := recordAdditionalData(&entry)
+		if err != nil {
+			log.Printf("Error parsing record: %v", err)
+			continue
+		}
+
 		// Decrypt the message
-		decryptedMessage, err := decryptor.Decrypt(entry.Nonce, entry.EncryptedData)
+		decryptedMessage, err := decryptor.Decrypt(entry.Nonce, entry.EncryptedData, additionalData)
 		if err != nil {
 			log.Printf("Error decrypting message: %v", err)
 			continue
 		}
 
+		if showLabels && len(entry.Labels) > 0 {
+			labels, err := decryptor.DecryptLabels(entry.Labels)
+			if err != nil {
+				log.Printf("Error decrypting labels: %v", err)
+				continue
+			}
+			decryptedMessage = formatLabels(labels) + decryptedMessage
+		}
+
+		// Sorting needs the whole input, so buffer records until EOF
+		if sortOutput {
+			sorted = append(sorted, decryptedRecord{time: timeFilter.Time(&entry), message: decryptedMessage})
+			continue
+		}
+
 		// Output the original log message to stdout and add newline 
 		// (since encryptor strips newlines during processing)
 		fmt.Printf("%s\n", decryptedMessage)
@@ -99,4 +162,27 @@ func main() {
 	if err := scanner.Err(); err != nil {
 		log.Fatalf("Error reading from stdin: %v", err)
 	}
-}
\ No newline at end of file
+
+	if sortOutput {
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].time.Before(sorted[j].time)
+		})
+		for _, record := range sorted {
+			fmt.Printf("%s\n", record.message)
+		}
+	}
+}
+
+// decryptedRecord is a decrypted message buffered for sorted output
+type decryptedRecord struct {
+	time    time.Time
+	message string
+}
+
+// matchesRoute reports whether a record's route matches the ROUTE filter
+func matchesRoute(route, filter string) bool {
+	if route == "" {
+		route = "default"
+	}
+	return route == filter
+}
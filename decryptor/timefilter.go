@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// TimeFilter selects and orders records by their receive or original timestamp
+type TimeFilter struct {
+	useOriginal bool      // Use the sender's timestamp ("o") instead of the receive time ("t")
+	since       time.Time // Inclusive lower bound (zero = unbounded)
+	until       time.Time // Exclusive upper bound (zero = unbounded)
+}
+
+// NewTimeFilterFromEnv reads TIME_FIELD, SINCE and UNTIL
+func NewTimeFilterFromEnv() (*TimeFilter, error) {
+	f := &TimeFilter{}
+
+	switch field := os.Getenv("TIME_FIELD"); field {
+	case "", "received", "t":
+	case "original", "o":
+		f.useOriginal = true
+	default:
+		return nil, fmt.Errorf("invalid TIME_FIELD %q (expected received or original)", field)
+	}
+
+	var err error
+	if f.since, err = parseBound("SINCE"); err != nil {
+		return nil, err
+	}
+	if f.until, err = parseBound("UNTIL"); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseBound(name string) (time.Time, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s (expected RFC3339 timestamp): %w", name, err)
+	}
+	return t, nil
+}
+
+// Time returns the timestamp of an entry used for filtering and sorting.
+// Records without an original timestamp fall back to the receive time.
+func (f *TimeFilter) Time(entry *EncryptedLogEntry) time.Time {
+	value := entry.Timestamp
+	if f.useOriginal && entry.OriginalTime != "" {
+		value = entry.OriginalTime
+	}
+	t, _ := time.Parse(time.RFC3339Nano, value)
+	return t
+}
+
+// Match reports whether an entry falls inside the SINCE/UNTIL window
+func (f *TimeFilter) Match(entry *EncryptedLogEntry) bool {
+	if f.since.IsZero() && f.until.IsZero() {
+		return true
+	}
+	t := f.Time(entry)
+	if !f.since.IsZero() && t.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !t.Before(f.until) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// fileIdentity falls back to the path where inodes are not available, so renamed
+// files are treated as new files
+func fileIdentity(path string, info os.FileInfo) string {
+	return path
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// fingerprintSize is how many leading bytes of a file identify it in checkpoints,
+// so a reused inode is not mistaken for the file that was checkpointed
+const fingerprintSize = 1024
+
+var (
+	// errFileTruncated is returned by followReader when the file shrank (copytruncate)
+	errFileTruncated = errors.New("file truncated")
+	// errTailStopped is returned by followReader on shutdown; unlike io.EOF it makes the
+	// parser keep an incomplete last line instead of returning it
+	errTailStopped = errors.New("tailing stopped")
+)
+
+// FileTailConfig holds options for a file listener
+type FileTailConfig struct {
+	Paths          []string      // Paths or globs of the files to follow
+	CheckpointFile string        // Where read offsets are persisted ("" = not persisted)
+	PollInterval   time.Duration // How often files are checked for new data, rotation and new matches
+	FromEnd        bool          // Start files found at startup without a checkpoint at their end
+	Framing        Framing       // Frame detection mode (delimited by default)
+	Delimiter      byte          // Delimiter for delimited framing (LF or NUL)
+	TrimCR         bool          // Strip the CR of CRLF line endings
+	MaxFrameSize   int           // Maximum octet-counted frame size in bytes
+	CRI            bool          // Lines are Kubernetes CRI container log records with pod metadata in the path
+}
+
+// fileCheckpoint is the persisted read position of one file
+type fileCheckpoint struct {
+	Path            string `json:"path"`
+	ID              string `json:"id"` // Device and inode
+	Fingerprint     string `json:"fingerprint"`
+	FingerprintSize int    `json:"fingerprint_size"`
+	Offset          int64  `json:"offset"`
+}
+
+// FileTailer follows log files like tail -F: it picks up files matching its globs,
+// follows them across rename and copytruncate rotation, and checkpoints read offsets
+// so a restart continues where the previous run stopped.
+type FileTailer struct {
+	pipeline    *Pipeline
+	source      *Source
+	config      FileTailConfig
+	mu          sync.Mutex
+	checkpoints map[string]*fileCheckpoint // By file identity
+	active      map[string]bool            // Identities with a running follower
+	dirty       bool                       // Checkpoints changed since the last save
+	stop        chan struct{}
+	followers   sync.WaitGroup
+	cleanupOnce sync.Once
+}
+
+func NewFileTailer(pipeline *Pipeline, source *Source, config FileTailConfig) *FileTailer {
+	return &FileTailer{
+		pipeline:    pipeline,
+		source:      source,
+		config:      config,
+		checkpoints: make(map[string]*fileCheckpoint),
+		active:      make(map[string]bool),
+		stop:        make(chan struct{}),
+	}
+}
+
+// Start follows matching files until Cleanup is called
+func (t *FileTailer) Start() error {
+	for _, pattern := range t.config.Paths {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid path pattern %q: %w", pattern, err)
+		}
+	}
+	if err := t.loadCheckpoints(); err != nil {
+		return err
+	}
+	log.Printf("File tailer following %v (checkpoints: %s)", t.config.Paths, t.checkpointName())
+
+	ticker := time.NewTicker(t.config.PollInterval)
+	defer ticker.Stop()
+	for first := true; ; first = false {
+		t.scan(first)
+		if err := t.saveCheckpoints(); err != nil {
+			log.Printf("Error saving file checkpoints: %v", err)
+		}
+		select {
+		case <-t.stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *FileTailer) checkpointName() string {
+	if t.config.CheckpointFile == "" {
+		return "disabled"
+	}
+	return t.config.CheckpointFile
+}
+
+// scan starts a follower for every matching file that is not followed yet and forgets
+// checkpoints of files that no longer exist
+func (t *FileTailer) scan(startup bool) {
+	seen := make(map[string]bool)
+	for _, pattern := range t.config.Paths {
+		matches, _ := filepath.Glob(pattern)
+		sort.Strings(matches)
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+			id := fileIdentity(path, info)
+			seen[id] = true
+
+			t.mu.Lock()
+			active := t.active[id]
+			t.mu.Unlock()
+			if !active {
+				t.open(path, id, info, startup)
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range t.checkpoints {
+		if !seen[id] && !t.active[id] {
+			delete(t.checkpoints, id)
+			t.dirty = true
+		}
+	}
+	SetTailedFiles(t.source.Name, len(t.active))
+}
+
+// open starts following a file from its checkpoint, or from the start (or end, for
+// files present at startup with FromEnd) when it has none
+func (t *FileTailer) open(path, id string, info os.FileInfo, startup bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error opening %s: %v", path, err)
+		return
+	}
+
+	var offset int64
+	if startup && t.config.FromEnd {
+		offset = info.Size()
+	}
+	t.mu.Lock()
+	checkpoint := t.checkpoints[id]
+	t.mu.Unlock()
+	if checkpoint != nil {
+		switch {
+		case checkpoint.Fingerprint != fingerprint(file, checkpoint.FingerprintSize):
+			// The inode was reused for a different file
+			offset = 0
+		case checkpoint.Offset > info.Size():
+			log.Printf("File %s shrank while not followed, reading from the start", path)
+			offset = 0
+		default:
+			offset = checkpoint.Offset
+		}
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		log.Printf("Error seeking %s: %v", path, err)
+		file.Close()
+		return
+	}
+
+	t.mu.Lock()
+	t.active[id] = true
+	t.checkpoints[id] = &fileCheckpoint{Path: path, ID: id, Offset: offset}
+	t.updateFingerprint(file, t.checkpoints[id])
+	t.dirty = true
+	t.mu.Unlock()
+
+	log.Printf("Following %s from offset %d", path, offset)
+	t.followers.Add(1)
+	go t.follow(&followReader{tailer: t, file: file, path: path, id: id, offset: offset, marked: offset})
+}
+
+// follow reads messages from a file until it is rotated away and drained, or until shutdown
+func (t *FileTailer) follow(r *followReader) {
+	defer t.followers.Done()
+	defer r.file.Close()
+	defer func() {
+		t.mu.Lock()
+		delete(t.active, r.id)
+		r.finished = true
+		t.mu.Unlock()
+	}()
+
+	meta := Metadata{"file": r.path}
+	if t.config.CRI {
+		meta = criPodMetadata(r.path)
+	}
+	process := func(message []byte, meta Metadata, original time.Time) {
+		if err := t.pipeline.ProcessThen(t.source, message, meta, original, nil); err != nil {
+			log.Printf("Error processing %s line: %v", r.path, err)
+		}
+	}
+
+	for {
+		parser := NewFramedMessageParser(r, t.config.Framing, t.config.Delimiter, t.config.MaxFrameSize)
+		parser.SetLimit(t.source.Name, t.source.Limit)
+		multiline := NewMultiline(t.source, process)
+
+		var err error
+		if t.config.CRI {
+			// The message limit applies to rejoined records; runtime lines are short
+			parser.SetLimit(t.source.Name, MessageLimit{MaxSize: t.config.MaxFrameSize, Policy: SizePolicyDrop})
+			err = t.readCRIMessages(r, parser, multiline, process, meta)
+		} else {
+			err = t.readMessages(r, parser, multiline, process, meta)
+		}
+		if multiline != nil {
+			multiline.Flush()
+		}
+		// Records emitted by the flush complete the lines read so far
+		r.idle()
+		switch {
+		case err == errFileTruncated:
+			// copytruncate: the data before the truncation was already read
+			log.Printf("File %s was truncated, reading from the start", r.path)
+			if _, err := r.file.Seek(0, io.SeekStart); err != nil {
+				log.Printf("Error seeking %s: %v", r.path, err)
+				return
+			}
+			r.offset = 0
+			r.marked = 0
+			t.mu.Lock()
+			r.generation++
+			t.updateFingerprint(r.file, t.checkpoints[r.id])
+			t.mu.Unlock()
+			t.commit(r, r.generation, 0)
+			continue
+		case err == io.EOF:
+			log.Printf("Finished %s after rotation", r.path)
+		case err != errTailStopped:
+			log.Printf("Error reading %s: %v", r.path, err)
+		}
+		return
+	}
+}
+
+// readMessages passes messages to the pipeline. The checkpoint moves past a message
+// once its record was output, and never past lines held by multiline reassembly.
+func (t *FileTailer) readMessages(r *followReader, parser *MessageParser, multiline *Multiline, process func([]byte, Metadata, time.Time), meta Metadata) error {
+	// At the end of the file, lines that no longer wait for reassembly are complete
+	r.idle = func() {
+		if parser.AtBoundary() && multiline.Held() == 0 {
+			t.commitAfter(r, r.offset-int64(parser.Buffered()))
+		}
+	}
+	start := r.offset - int64(parser.Buffered())
+	for {
+		message, err := parser.ReadMessage()
+		if err != nil {
+			return err
+		}
+		lineStart := start
+		start = r.offset - int64(parser.Buffered())
+		if !parser.AtBoundary() {
+			// Split parts are output, but the checkpoint waits for the whole message
+			lineStart = -1
+			start = -1
+		}
+
+		if t.config.TrimCR {
+			message = bytes.TrimSuffix(message, []byte{'\r'})
+		}
+		message = StripTrailingNewline(message)
+		if len(message) == 0 {
+			continue
+		}
+		RecordProcessedLog(t.source.Name, len(message))
+		switch {
+		case multiline != nil:
+			multiline.Add(message, meta)
+			// Lines before the first held line are output
+			switch multiline.Held() {
+			case 0:
+				t.commitAfter(r, start)
+			case 1:
+				t.commitAfter(r, lineStart)
+			}
+		case start > r.marked:
+			r.marked = start
+			if err := t.pipeline.ProcessThen(t.source, message, meta, time.Time{}, t.committer(r, start)); err != nil {
+				log.Printf("Error processing %s line: %v", r.path, err)
+			}
+		default:
+			process(message, meta, time.Time{})
+		}
+	}
+}
+
+// readCRIMessages rejoins partial container log lines and passes each record to the
+// pipeline with its stream and the time the runtime logged it. The checkpoint only moves past lines whose records were
+// output, and never past a held partial line or multiline record.
+func (t *FileTailer) readCRIMessages(r *followReader, parser *MessageParser, multiline *Multiline, process func([]byte, Metadata, time.Time), meta Metadata) error {
+	reassembler := newCRIReassembler(t.source.Name, t.source.Limit)
+	r.idle = func() {
+		if parser.AtBoundary() && !reassembler.Pending() && multiline.Held() == 0 {
+			t.commitAfter(r, r.offset-int64(parser.Buffered()))
+		}
+	}
+	// Offset after the last line that left no partial line held
+	complete := r.offset - int64(parser.Buffered())
+	streamMeta := make(map[string]Metadata)
+	for {
+		line, err := parser.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		stream, logged, records, err := reassembler.Add(StripTrailingNewline(line))
+		if err != nil {
+			RecordParseFailure(t.source.Name)
+			log.Printf("Skipping line of %s: %v", r.path, err)
+		}
+		if records != nil && streamMeta[stream] == nil {
+			streamMeta[stream] = Metadata{"stream": stream}
+			for k, v := range meta {
+				streamMeta[stream][k] = v
+			}
+		}
+		for _, record := range records {
+			RecordProcessedLog(t.source.Name, len(record))
+			if multiline != nil {
+				multiline.AddAt(record, streamMeta[stream], logged)
+			} else {
+				process(record, streamMeta[stream], logged)
+			}
+		}
+
+		if !parser.AtBoundary() || reassembler.Pending() {
+			continue
+		}
+		recordStart := complete
+		complete = r.offset - int64(parser.Buffered())
+		switch multiline.Held() {
+		case 0:
+			t.commitAfter(r, complete)
+		case 1:
+			// The held line is a record completed by this line, which started at recordStart
+			if len(records) > 0 {
+				t.commitAfter(r, recordStart)
+			}
+		}
+	}
+}
+
+// commitAfter moves the checkpoint to offset once the records of all messages queued
+// before were output. Called by the follower only.
+func (t *FileTailer) commitAfter(r *followReader, offset int64) {
+	if offset <= r.marked {
+		return
+	}
+	r.marked = offset
+	if err := t.pipeline.Mark(t.committer(r, offset)); err != nil {
+		log.Printf("Error queueing %s checkpoint: %v", r.path, err)
+	}
+}
+
+// committer returns the callback that moves the checkpoint to offset once a record
+// was output. Called by the follower only, which is the only writer of generation.
+func (t *FileTailer) committer(r *followReader, offset int64) func() {
+	generation := r.generation
+	return func() {
+		t.commit(r, generation, offset)
+	}
+}
+
+// commit records that everything before offset was output. Offsets read before the
+// file was truncated are ignored.
+func (t *FileTailer) commit(r *followReader, generation int, offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	checkpoint := t.checkpoints[r.id]
+	if checkpoint == nil || generation != r.generation {
+		return
+	}
+	checkpoint.Offset = offset
+	// A finished follower has closed the file
+	if !r.finished && checkpoint.FingerprintSize < fingerprintSize && offset > int64(checkpoint.FingerprintSize) {
+		t.updateFingerprint(r.file, checkpoint)
+	}
+	t.dirty = true
+}
+
+// updateFingerprint hashes the leading bytes of a file that has grown past its fingerprint
+func (t *FileTailer) updateFingerprint(file *os.File, checkpoint *fileCheckpoint) {
+	size := fingerprintSize
+	if info, err := file.Stat(); err == nil && info.Size() < int64(size) {
+		size = int(info.Size())
+	}
+	checkpoint.Fingerprint = fingerprint(file, size)
+	checkpoint.FingerprintSize = size
+}
+
+// fingerprint returns the hex SHA-256 of the first size bytes of a file
+func fingerprint(file *os.File, size int) string {
+	buf := make([]byte, size)
+	n, _ := file.ReadAt(buf, 0)
+	sum := sha256.Sum256(buf[:n])
+	return hex.EncodeToString(sum[:])
+}
+
+// loadCheckpoints reads the checkpoint file, if any
+func (t *FileTailer) loadCheckpoints() error {
+	if t.config.CheckpointFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(t.config.CheckpointFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint file: %w", err)
+	}
+
+	var state struct {
+		Files []*fileCheckpoint `json:"files"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("invalid checkpoint file %s: %w", t.config.CheckpointFile, err)
+	}
+	for _, checkpoint := range state.Files {
+		t.checkpoints[checkpoint.ID] = checkpoint
+	}
+	return nil
+}
+
+// saveCheckpoints atomically replaces the checkpoint file when offsets changed
+func (t *FileTailer) saveCheckpoints() error {
+	if t.config.CheckpointFile == "" {
+		return nil
+	}
+
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	var state struct {
+		Files []fileCheckpoint `json:"files"`
+	}
+	for _, checkpoint := range t.checkpoints {
+		state.Files = append(state.Files, *checkpoint)
+	}
+	t.dirty = false
+	t.mu.Unlock()
+
+	// Offsets cover records handed to the outputs; flush them before the offsets are saved
+	if err := t.pipeline.Flush(); err != nil {
+		t.mu.Lock()
+		t.dirty = true
+		t.mu.Unlock()
+		return fmt.Errorf("failed to flush output: %w", err)
+	}
+
+	sort.Slice(state.Files, func(i, j int) bool { return state.Files[i].Path < state.Files[j].Path })
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write a temporary file and rename it so a crash never leaves a partial checkpoint
+	tmp := t.config.CheckpointFile + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.config.CheckpointFile)
+}
+
+// Cleanup stops all followers and saves the final offsets
+func (t *FileTailer) Cleanup() {
+	t.cleanupOnce.Do(func() {
+		log.Printf("Stopping file tailer...")
+		close(t.stop)
+		t.followers.Wait()
+		t.pipeline.Drain()
+		if err := t.saveCheckpoints(); err != nil {
+			log.Printf("Error saving file checkpoints: %v", err)
+		}
+	})
+}
+
+// followReader reads a file that is still being written. At the end of the file it
+// waits for more data, and ends with io.EOF only once the file was rotated away and
+// fully read.
+type followReader struct {
+	tailer  *FileTailer
+	file    *os.File
+	path    string
+	id      string
+	offset  int64  // Bytes read from the file
+	rotated bool   // The path now names another file (or none); read once more, then stop
+	idle    func() // Called at the end of the file before waiting for more data
+	marked  int64  // Last offset queued for checkpointing
+
+	// Guarded by tailer.mu
+	generation int  // Incremented on truncation, so offsets read before are not committed
+	finished   bool // The follower stopped and closes the file
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.file.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		if info, err := r.file.Stat(); err == nil && info.Size() < r.offset {
+			return 0, errFileTruncated
+		}
+		if r.rotated {
+			return 0, io.EOF
+		}
+		// Writers may still append briefly after a rename, so drain one more interval
+		if info, err := os.Stat(r.path); err != nil || fileIdentity(r.path, info) != r.id {
+			r.rotated = true
+		}
+
+		r.idle()
+		select {
+		case <-r.tailer.stop:
+			return 0, errTailStopped
+		case <-time.After(r.tailer.config.PollInterval):
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+)
+
+// FilterConfig describes a filter rule from the FILTERS environment variable.
+// All non-empty match fields must match for the rule to apply.
+type FilterConfig struct {
+	Name     string `json:"name"`
+	Action   string `json:"action"`   // "drop" or "keep"
+	Listener string `json:"listener"` // listener routing tag glob (e.g. "dmz-*")
+	Tag      string `json:"tag"`      // app-name/tag glob (e.g. "mysqld")
+	Facility string `json:"facility"` // comma-separated facility names or numbers (e.g. "local0,local1")
+	Severity string `json:"severity"` // comma-separated severity names or numbers (e.g. "info,debug")
+	Pattern  string `json:"pattern"`  // regex matched against the message body
+}
+
+// FilterRule drops or keeps matching messages before encryption
+type FilterRule struct {
+	name       string
+	drop       bool
+	listener   string
+	tag        string
+	facilities map[int]bool // nil matches any facility
+	severities map[int]bool // nil matches any severity
+	pattern    *regexp.Regexp
+}
+
+// ParseFilterConfigs decodes the JSON array from the FILTERS environment variable
+func ParseFilterConfigs(raw string) ([]FilterConfig, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var configs []FilterConfig
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		return nil, fmt.Errorf("invalid FILTERS JSON: %w", err)
+	}
+	return configs, nil
+}
+
+// NewFilterRules validates filter rules
+func NewFilterRules(configs []FilterConfig) ([]*FilterRule, error) {
+	var rules []*FilterRule
+	for i, cfg := range configs {
+		name := cfg.Name
+		if name == "" {
+			name = fmt.Sprintf("filter%d", i+1)
+		}
+		rule := &FilterRule{name: name, listener: cfg.Listener, tag: cfg.Tag}
+
+		switch cfg.Action {
+		case "drop":
+			rule.drop = true
+		case "keep":
+		default:
+			return nil, fmt.Errorf("filter %s: unknown action %q (expected drop or keep)", name, cfg.Action)
+		}
+
+		for field, glob := range map[string]string{"listener": cfg.Listener, "tag": cfg.Tag} {
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("filter %s: invalid %s pattern: %w", name, field, err)
+			}
+		}
+
+		if cfg.Facility != "" {
+			rule.facilities = make(map[int]bool)
+			for _, value := range splitList(cfg.Facility) {
+				facility, ok := ParseFacility(value)
+				if !ok {
+					return nil, fmt.Errorf("filter %s: unknown facility %q", name, value)
+				}
+				rule.facilities[facility] = true
+			}
+		}
+		if cfg.Severity != "" {
+			rule.severities = make(map[int]bool)
+			for _, value := range splitList(cfg.Severity) {
+				severity, ok := ParseSeverity(value)
+				if !ok {
+					return nil, fmt.Errorf("filter %s: unknown severity %q", name, value)
+				}
+				rule.severities[severity] = true
+			}
+		}
+
+		if cfg.Pattern != "" {
+			pattern, err := regexp.Compile(cfg.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("filter %s: invalid pattern: %w", name, err)
+			}
+			rule.pattern = pattern
+		}
+
+		log.Printf("Filter %s: action=%s listener=%q tag=%q facility=%q severity=%q pattern=%q", name, cfg.Action, cfg.Listener, cfg.Tag, cfg.Facility, cfg.Severity, cfg.Pattern)
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// matches reports whether a message meets all of the rule's conditions. Header conditions
+// never match messages that are not syslog.
+func (rule *FilterRule) matches(msg *LogMessage, parsed *SyslogMessage) bool {
+	if rule.listener != "" {
+		if ok, _ := path.Match(rule.listener, msg.Source.Tag); !ok {
+			return false
+		}
+	}
+	if parsed == nil && (rule.facilities != nil || rule.severities != nil || rule.tag != "") {
+		return false
+	}
+	if rule.facilities != nil && !rule.facilities[parsed.Facility] {
+		return false
+	}
+	if rule.severities != nil && !rule.severities[parsed.Severity] {
+		return false
+	}
+	if rule.tag != "" {
+		if ok, _ := path.Match(rule.tag, parsed.AppName); !ok {
+			return false
+		}
+	}
+	if rule.pattern != nil {
+		body := msg.Data
+		if parsed != nil {
+			body = parsed.Message
+		}
+		if !rule.pattern.Match(body) {
+			return false
+		}
+	}
+	return true
+}
+
+// filtered applies the first matching rule and reports whether the message is dropped.
+// Messages matching no rule are kept.
+func filtered(rules []*FilterRule, msg *LogMessage) bool {
+	if len(rules) == 0 {
+		return false
+	}
+	parsed := msg.Parsed()
+	for _, rule := range rules {
+		if rule.matches(msg, parsed) {
+			RecordFilteredLog(msg.Source.Name, rule.name, rule.drop)
+			return rule.drop
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseFacilityAndSeverity(t *testing.T) {
+	facilities := []struct {
+		name string
+		code int
+		ok   bool
+	}{
+		{"kern", 0, true},
+		{"authpriv", 10, true},
+		{"LOCAL0", 16, true},
+		{"local7", 23, true},
+		{"23", 23, true},
+		{"0", 0, true},
+		{"24", 0, false},
+		{"-1", 0, false},
+		{"local8", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range facilities {
+		if code, ok := ParseFacility(tt.name); code != tt.code || ok != tt.ok {
+			t.Errorf("ParseFacility(%q) = %d, %v, want %d, %v", tt.name, code, ok, tt.code, tt.ok)
+		}
+	}
+
+	severities := []struct {
+		name string
+		code int
+		ok   bool
+	}{
+		{"emerg", 0, true},
+		{"panic", 0, true},
+		{"err", 3, true},
+		{"error", 3, true},
+		{"Warning", 4, true},
+		{"warn", 4, true},
+		{"debug", 7, true},
+		{"6", 6, true},
+		{"8", 0, false},
+		{"verbose", 0, false},
+	}
+	for _, tt := range severities {
+		if code, ok := ParseSeverity(tt.name); code != tt.code || ok != tt.ok {
+			t.Errorf("ParseSeverity(%q) = %d, %v, want %d, %v", tt.name, code, ok, tt.code, tt.ok)
+		}
+	}
+}
+
+func TestNewFilterRulesErrors(t *testing.T) {
+	tests := []FilterConfig{
+		{Action: "reject"},
+		{Action: ""},
+		{Action: "drop", Facility: "local0,mail2"},
+		{Action: "drop", Severity: "info,loud"},
+		{Action: "drop", Tag: "app-["},
+		{Action: "drop", Listener: "["},
+		{Action: "drop", Pattern: "("},
+	}
+	for _, cfg := range tests {
+		if _, err := NewFilterRules([]FilterConfig{cfg}); err == nil {
+			t.Errorf("NewFilterRules(%+v) succeeded, want error", cfg)
+		}
+	}
+}
+
+func TestFiltered(t *testing.T) {
+	rules, err := NewFilterRules([]FilterConfig{
+		{Name: "keep-sshd", Action: "keep", Tag: "sshd"},
+		{Name: "drop-debug", Action: "drop", Severity: "debug"},
+		{Name: "drop-health", Action: "drop", Pattern: `^GET /health`},
+		{Name: "drop-dmz-local", Action: "drop", Listener: "dmz-*", Facility: "local0,local1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		listener string // Routing tag of the source
+		data     string
+		dropped  bool
+	}{
+		// The first matching rule decides, so the keep rule wins over later drop rules
+		{"kept before a later drop", "", "<191>Oct 18 10:00:00 host sshd[1]: debug1: session", false},
+		{"dropped by severity", "", "<191>Oct 18 10:00:00 host app: debug output", true},
+		{"no rule matches", "", "<134>Oct 18 10:00:00 host app: info output", false},
+		{"pattern on the syslog body", "", "<134>Oct 18 10:00:00 host nginx: GET /health 200", true},
+		{"pattern not on the header", "", "<134>Oct 18 10:00:00 host GET: /health", false},
+		{"listener and facility", "dmz-web", "<134>Oct 18 10:00:00 host app: x", true},
+		{"listener without facility", "dmz-web", "<14>Oct 18 10:00:00 host app: x", false},
+		{"facility on another listener", "lan", "<134>Oct 18 10:00:00 host app: x", false},
+
+		// Messages that are not syslog never match header conditions, only patterns
+		{"unparsed against header rules", "dmz-web", "plain debug text", false},
+		{"unparsed with a pattern", "", "GET /health 200", true},
+		{"invalid priority", "", "<999>GET /health", false},
+	}
+	for _, tt := range tests {
+		source := &Source{Name: "test", Tag: tt.listener, SyslogFormat: SyslogFormatNone}
+		msg := source.NewMessage([]byte(tt.data), nil)
+		if got := filtered(rules, msg); got != tt.dropped {
+			t.Errorf("%s: filtered(%q) = %v, want %v", tt.name, tt.data, got, tt.dropped)
+		}
+	}
+
+	if filtered(nil, (&Source{Name: "test"}).NewMessage([]byte("x"), nil)) {
+		t.Error("message dropped without rules")
+	}
+}
+
+func TestPipelineFilteredDone(t *testing.T) {
+	rules, err := NewFilterRules([]FilterConfig{{Action: "drop", Pattern: "^drop"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{0, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			encryptor := testEncryptor(t)
+			path := filepath.Join(t.TempDir(), "out.json")
+			router, err := NewRouter(encryptor.privateKey, encryptor, nil, rules, nil, nil, OutputConfig{Default: "file:" + path})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer router.Close()
+			pipeline := NewPipeline(router, workers, 8)
+			source := &Source{Name: "test"}
+
+			// Dropped messages are done in queue order like written ones, so a file
+			// checkpoint moves past them
+			var done []string
+			messages := []string{"keep 1", "drop 2", "drop 3", "keep 4", "drop 5"}
+			for _, message := range messages {
+				message := message
+				if err := pipeline.ProcessThen(source, []byte(message), nil, time.Time{}, func() { done = append(done, message) }); err != nil {
+					t.Fatal(err)
+				}
+			}
+			pipeline.Close()
+
+			if fmt.Sprint(done) != fmt.Sprint(messages) {
+				t.Errorf("done = %q, want %q", done, messages)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if records := bytes.Count(data, []byte("\n")); records != 2 {
+				t.Errorf("wrote %d records, want 2", records)
+			}
+		})
+	}
+}
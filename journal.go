@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// journalField is one FIELD=value pair of a journal entry. Fields may repeat.
+type journalField struct {
+	name  string
+	value []byte
+}
+
+// parseJournalFields decodes the field serialization shared by the journal export format
+// (journalctl -o export) and the native journal protocol: text fields are "NAME=value\n",
+// binary-safe fields are "NAME\n", a little-endian 64-bit length, the value and "\n".
+// It returns the fields and the number of bytes consumed, stopping after an empty line
+// (the export format's entry separator). complete is false when data ends mid-field.
+func parseJournalFields(data []byte) (fields []journalField, consumed int, complete bool, err error) {
+	pos := 0
+	for pos < len(data) {
+		end := bytes.IndexByte(data[pos:], '\n')
+		if end == 0 {
+			return fields, pos + 1, true, nil // Entry separator
+		}
+		if end < 0 {
+			return fields, pos, false, nil
+		}
+		line := data[pos : pos+end]
+
+		if eq := bytes.IndexByte(line, '='); eq >= 0 {
+			name := string(line[:eq])
+			if !validJournalFieldName(name) {
+				return nil, 0, false, fmt.Errorf("invalid journal field name %q", name)
+			}
+			fields = append(fields, journalField{name: name, value: line[eq+1:]})
+			pos += end + 1
+			continue
+		}
+
+		// Binary field: the name line is followed by the length and the raw value
+		name := string(line)
+		if !validJournalFieldName(name) {
+			return nil, 0, false, fmt.Errorf("invalid journal field name %q", name)
+		}
+		start := pos + end + 1
+		if len(data) < start+8 {
+			return fields, pos, false, nil
+		}
+		size := binary.LittleEndian.Uint64(data[start : start+8])
+		if size > uint64(len(data)) {
+			// Cannot be complete yet; the caller bounds how much it buffers
+			return fields, pos, false, nil
+		}
+		valueEnd := start + 8 + int(size)
+		if len(data) < valueEnd+1 {
+			// The native protocol may omit the final newline
+			if len(data) == valueEnd {
+				fields = append(fields, journalField{name: name, value: data[start+8 : valueEnd]})
+				return fields, valueEnd, false, nil
+			}
+			return fields, pos, false, nil
+		}
+		if data[valueEnd] != '\n' {
+			return nil, 0, false, fmt.Errorf("journal field %s is not terminated by a newline", name)
+		}
+		fields = append(fields, journalField{name: name, value: data[start+8 : valueEnd]})
+		pos = valueEnd + 1
+	}
+	return fields, pos, false, nil
+}
+
+// validJournalFieldName checks the journal's field name rules: uppercase letters, digits
+// and underscores, not starting with a digit
+func validJournalFieldName(name string) bool {
+	if name == "" || len(name) > 64 || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeJournalEntry returns the entry as a JSON object with sorted keys, the plaintext that
+// is encrypted. As with journalctl -o json, values that are not valid UTF-8 become arrays of
+// byte values and repeated fields become arrays.
+func encodeJournalEntry(fields []journalField) ([]byte, error) {
+	entry := make(map[string]any, len(fields))
+	for _, field := range fields {
+		var value any = string(field.value)
+		if !utf8.Valid(field.value) {
+			bytes := make([]int, len(field.value))
+			for i, b := range field.value {
+				bytes[i] = int(b)
+			}
+			value = bytes
+		}
+
+		switch existing := entry[field.name].(type) {
+		case nil:
+			entry[field.name] = value
+		case []any:
+			entry[field.name] = append(existing, value)
+		default:
+			entry[field.name] = []any{existing, value}
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(entry); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
+
+// parseJournalDatagram converts a native journal protocol datagram to a JSON entry. Like
+// journald, it drops client-supplied trusted fields (leading underscore) and adds the
+// kernel-verified sender credentials instead.
+func parseJournalDatagram(data []byte, meta Metadata) ([]byte, error) {
+	fields, consumed, _, err := parseJournalFields(data)
+	if err != nil {
+		return nil, err
+	}
+	if consumed != len(data) || len(fields) == 0 {
+		return nil, fmt.Errorf("incomplete journal entry")
+	}
+
+	trusted := fields[:0]
+	for _, field := range fields {
+		if field.name[0] != '_' {
+			trusted = append(trusted, field)
+		}
+	}
+	for _, cred := range []struct{ meta, field string }{{"pid", "_PID"}, {"uid", "_UID"}, {"gid", "_GID"}} {
+		if value, ok := meta[cred.meta]; ok {
+			trusted = append(trusted, journalField{name: cred.field, value: []byte(value)})
+		}
+	}
+	return encodeJournalEntry(trusted)
+}
+
+// readJournalEntry reads one entry of a journal export stream and returns it as JSON
+func (p *MessageParser) readJournalEntry() ([]byte, error) {
+	for {
+		fields, consumed, complete, err := parseJournalFields(p.buffer)
+		if err != nil {
+			return nil, err
+		}
+		if p.maxFrameSize > 0 && consumed > p.maxFrameSize {
+			return nil, ErrFrameTooLarge
+		}
+		if complete {
+			entry, err := encodeJournalEntry(fields)
+			p.buffer = append(p.buffer[:0], p.buffer[consumed:]...)
+			if err != nil {
+				return nil, err
+			}
+			if len(fields) == 0 {
+				continue // Extra empty line
+			}
+			return entry, nil
+		}
+		if p.maxFrameSize > 0 && len(p.buffer) > p.maxFrameSize {
+			return nil, ErrFrameTooLarge
+		}
+
+		if err := p.fill(len(p.buffer) + 1); err != nil {
+			if err == io.EOF && len(p.buffer) > 0 {
+				// The last entry may lack its separator
+				if consumed == len(p.buffer) && len(fields) > 0 {
+					p.buffer = p.buffer[:0]
+					return encodeJournalEntry(fields)
+				}
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+}
+
+// parseJournal fills syslog header fields from a JSON journal entry, so routing, filters
+// and metadata fields work as for syslog messages
+func parseJournal(data []byte) (*SyslogMessage, error) {
+	var entry map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("invalid journal entry: %w", err)
+	}
+	field := func(names ...string) string {
+		for _, name := range names {
+			var value string
+			if json.Unmarshal(entry[name], &value) == nil && value != "" {
+				return value
+			}
+			var values []string
+			if json.Unmarshal(entry[name], &values) == nil && len(values) > 0 {
+				return values[0]
+			}
+		}
+		return ""
+	}
+
+	// journald defaults to LOG_USER and LOG_INFO
+	msg := &SyslogMessage{Format: SyslogFormatJournal, Facility: 1, Severity: 6}
+	if facility, err := strconv.Atoi(field("SYSLOG_FACILITY")); err == nil && facility >= 0 && facility <= 23 {
+		msg.Facility = facility
+	}
+	if severity, err := strconv.Atoi(field("PRIORITY")); err == nil && severity >= 0 && severity <= 7 {
+		msg.Severity = severity
+	}
+	if usec, err := strconv.ParseInt(field("_SOURCE_REALTIME_TIMESTAMP", "__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		msg.Timestamp = time.UnixMicro(usec)
+	}
+	msg.Hostname = field("_HOSTNAME")
+	msg.AppName = field("SYSLOG_IDENTIFIER", "_COMM")
+	msg.ProcID = field("SYSLOG_PID", "_PID")
+	msg.Message = []byte(field("MESSAGE"))
+	return msg, nil
+}
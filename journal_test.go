@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// binaryJournalField encodes a field in the binary-safe form, without the final newline
+func binaryJournalField(name, value string) string {
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	return name + "\n" + string(size[:]) + value
+}
+
+func TestParseJournalFields(t *testing.T) {
+	type field struct{ name, value string }
+	tests := []struct {
+		name     string
+		data     string
+		want     []field
+		consumed int // -1 for len(data)
+		complete bool
+		wantErr  bool
+	}{
+		{
+			name:     "text fields",
+			data:     "MESSAGE=hello\nPRIORITY=6\n",
+			want:     []field{{"MESSAGE", "hello"}, {"PRIORITY", "6"}},
+			consumed: -1,
+		},
+		{
+			name:     "entry separator",
+			data:     "MESSAGE=one\n\nMESSAGE=two\n",
+			want:     []field{{"MESSAGE", "one"}},
+			consumed: len("MESSAGE=one\n\n"),
+			complete: true,
+		},
+		{
+			name:     "repeated field and value with equals sign",
+			data:     "TAG=a\nTAG=b=c\nEMPTY=\n\n",
+			want:     []field{{"TAG", "a"}, {"TAG", "b=c"}, {"EMPTY", ""}},
+			consumed: -1,
+			complete: true,
+		},
+		{
+			name:     "binary field with newlines",
+			data:     binaryJournalField("MESSAGE", "line one\nline two\n") + "\nPRIORITY=3\n\n",
+			want:     []field{{"MESSAGE", "line one\nline two\n"}, {"PRIORITY", "3"}},
+			consumed: -1,
+			complete: true,
+		},
+		{
+			name:     "binary field with zero bytes",
+			data:     binaryJournalField("COREDUMP", "\x00\x01\xff") + "\n",
+			want:     []field{{"COREDUMP", "\x00\x01\xff"}},
+			consumed: -1,
+		},
+		{
+			name:     "empty binary field",
+			data:     binaryJournalField("MESSAGE", "") + "\n\n",
+			want:     []field{{"MESSAGE", ""}},
+			consumed: -1,
+			complete: true,
+		},
+		{
+			// The native protocol may end a datagram without the final newline
+			name:     "binary field at the end without newline",
+			data:     "PRIORITY=6\n" + binaryJournalField("MESSAGE", "last"),
+			want:     []field{{"PRIORITY", "6"}, {"MESSAGE", "last"}},
+			consumed: -1,
+		},
+		{
+			name:     "text line not yet complete",
+			data:     "PRIORITY=6\nMESSAGE=hal",
+			want:     []field{{"PRIORITY", "6"}},
+			consumed: len("PRIORITY=6\n"),
+		},
+		{
+			name:     "binary length not yet complete",
+			data:     "PRIORITY=6\nMESSAGE\n\x05\x00\x00",
+			want:     []field{{"PRIORITY", "6"}},
+			consumed: len("PRIORITY=6\n"),
+		},
+		{
+			name:     "binary value not yet complete",
+			data:     "PRIORITY=6\n" + binaryJournalField("MESSAGE", "hello")[:len("MESSAGE\n")+8+3],
+			want:     []field{{"PRIORITY", "6"}},
+			consumed: len("PRIORITY=6\n"),
+		},
+		{
+			name:     "binary length beyond the data",
+			data:     "MESSAGE\n\xff\xff\xff\xff\xff\xff\xff\xffvalue\n",
+			consumed: 0,
+		},
+		{name: "binary value not terminated", data: binaryJournalField("MESSAGE", "hello") + "X", wantErr: true},
+		{name: "lowercase name", data: "message=hello\n", wantErr: true},
+		{name: "name starting with a digit", data: "1MESSAGE=hello\n", wantErr: true},
+		{name: "empty name", data: "=hello\n", wantErr: true},
+		{name: "name too long", data: strings.Repeat("A", 65) + "=x\n", wantErr: true},
+		{name: "invalid binary field name", data: binaryJournalField("Message", "hello") + "\n", wantErr: true},
+		{name: "empty", data: "", consumed: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, consumed, complete, err := parseJournalFields([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseJournalFields(%q) succeeded, want error", tt.data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseJournalFields(%q): %v", tt.data, err)
+			}
+			var got []field
+			for _, f := range fields {
+				got = append(got, field{f.name, string(f.value)})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fields = %q, want %q", got, tt.want)
+			}
+			wantConsumed := tt.consumed
+			if wantConsumed < 0 {
+				wantConsumed = len(tt.data)
+			}
+			if consumed != wantConsumed || complete != tt.complete {
+				t.Errorf("consumed, complete = %d, %v, want %d, %v", consumed, complete, wantConsumed, tt.complete)
+			}
+		})
+	}
+}
+
+func TestEncodeJournalEntry(t *testing.T) {
+	fields := []journalField{
+		{name: "MESSAGE", value: []byte("<b>hi</b>")},
+		{name: "TAG", value: []byte("a")},
+		{name: "TAG", value: []byte("b")},
+		{name: "TAG", value: []byte{0xff}},
+		{name: "BLOB", value: []byte{0x00, 0xfe}},
+	}
+	got, err := encodeJournalEntry(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Values that are not UTF-8 are byte arrays, repeated fields are arrays
+	want := `{"BLOB":[0,254],"MESSAGE":"<b>hi</b>","TAG":["a","b",[255]]}`
+	if string(got) != want {
+		t.Errorf("encodeJournalEntry = %s, want %s", got, want)
+	}
+}
+
+func TestParseJournalDatagram(t *testing.T) {
+	data := "MESSAGE=hello\n_PID=1\n_UID=0\nSYSLOG_IDENTIFIER=app\n" + binaryJournalField("CODE_FILE", "a.c")
+	got, err := parseJournalDatagram([]byte(data), Metadata{"pid": "4242", "uid": "1000", "gid": "1000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Client-supplied trusted fields are replaced by the socket credentials
+	want := `{"CODE_FILE":"a.c","MESSAGE":"hello","SYSLOG_IDENTIFIER":"app","_GID":"1000","_PID":"4242","_UID":"1000"}`
+	if string(got) != want {
+		t.Errorf("parseJournalDatagram = %s, want %s", got, want)
+	}
+
+	for _, invalid := range []string{"", "MESSAGE=hello", "MESSAGE=one\n\nMESSAGE=two\n", "message=hello\n"} {
+		if _, err := parseJournalDatagram([]byte(invalid), nil); err == nil {
+			t.Errorf("parseJournalDatagram(%q) succeeded, want error", invalid)
+		}
+	}
+}
+
+func TestReadJournalEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunks  []string
+		max     int
+		want    []string
+		wantErr error
+	}{
+		{
+			name:   "entries split across reads",
+			chunks: []string{"MESSAGE=one\nPRI", "ORITY=6\n\n\nMESSAGE", "\n\x03\x00\x00\x00\x00\x00\x00\x00t\nw\n\n"},
+			want:   []string{`{"MESSAGE":"one","PRIORITY":"6"}`, `{"MESSAGE":"t\nw"}`},
+		},
+		{
+			name:   "last entry without separator",
+			chunks: []string{"MESSAGE=one\n\nMESSAGE=two\n"},
+			want:   []string{`{"MESSAGE":"one"}`, `{"MESSAGE":"two"}`},
+		},
+		{
+			name:    "entry cut off mid-field",
+			chunks:  []string{"MESSAGE=one\n\nMESSAGE=tw"},
+			want:    []string{`{"MESSAGE":"one"}`},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "entry over the frame limit",
+			chunks:  []string{"MESSAGE=" + strings.Repeat("x", 100) + "\n\n"},
+			max:     64,
+			wantErr: ErrFrameTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := NewFramedMessageParser(&chunkReader{chunks: tt.chunks}, FramingJournal, '\n', tt.max)
+			var got []string
+			var err error
+			for {
+				var message []byte
+				if message, err = parser.ReadMessage(); err != nil {
+					break
+				}
+				got = append(got, string(message))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+			want := tt.wantErr
+			if want == nil {
+				want = io.EOF
+			}
+			if err != want {
+				t.Errorf("error = %v, want %v", err, want)
+			}
+		})
+	}
+}
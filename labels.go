@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// LabelConfig holds the sources of the static labels added to every record
+type LabelConfig struct {
+	Static   string // "name=value" pairs (LABELS)
+	FromEnv  string // "name=VARIABLE" pairs (LABELS_FROM_ENV)
+	FromFile string // "name=/path" pairs, e.g. Kubernetes downward API files (LABELS_FROM_FILE)
+	Hostname string // Label name for the host name (LABEL_HOSTNAME)
+	Encrypt  bool   // Encrypt the labels instead of writing them in clear text
+}
+
+// Labels identify the host, pod or instance that produced a record. They are written to
+// the "h" field of every record and authenticated together with the message metadata.
+type Labels struct {
+	values  Metadata
+	encoded []byte // Canonical JSON of values
+	encrypt bool
+}
+
+// NewLabels reads the configured labels once at startup. It returns nil when no label
+// is configured, in which case records have no "h" field.
+func NewLabels(config LabelConfig) (*Labels, error) {
+	values := make(Metadata)
+	add := func(source, list string, value func(string) (string, error)) error {
+		for _, pair := range splitList(list) {
+			name, ref, ok := strings.Cut(pair, "=")
+			if !ok || name == "" {
+				return fmt.Errorf("%s: invalid entry %q (expected name=value)", source, pair)
+			}
+			if _, exists := values[name]; exists {
+				return fmt.Errorf("%s: duplicate label %q", source, name)
+			}
+			v, err := value(ref)
+			if err != nil {
+				return fmt.Errorf("%s: label %s: %w", source, name, err)
+			}
+			values[name] = v
+		}
+		return nil
+	}
+
+	if err := add("LABELS", config.Static, func(value string) (string, error) {
+		return value, nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := add("LABELS_FROM_ENV", config.FromEnv, func(variable string) (string, error) {
+		value, ok := os.LookupEnv(variable)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", variable)
+		}
+		return value, nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := add("LABELS_FROM_FILE", config.FromFile, func(path string) (string, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}); err != nil {
+		return nil, err
+	}
+	if config.Hostname != "" {
+		if err := add("LABEL_HOSTNAME", config.Hostname+"=", func(string) (string, error) {
+			return os.Hostname()
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(values) == 0 {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(map[string]string(values))
+	if err != nil {
+		return nil, err
+	}
+	visibility := "clear text"
+	if config.Encrypt {
+		visibility = "encrypted"
+	}
+	log.Printf("Record labels (%s): %s", visibility, encoded)
+	return &Labels{values: values, encoded: encoded, encrypt: config.Encrypt}, nil
+}
+
+// appendField appends the JSON value of the "h" field: the labels object, or with
+// encryption the base64 of nonce and ciphertext as a string
+func (l *Labels) appendField(dst []byte, encryptor *Encryptor) ([]byte, error) {
+	if !l.encrypt {
+		return append(dst, l.encoded...), nil
+	}
+
+	sealed := make([]byte, NonceSize, NonceSize+len(l.encoded)+16)
+	sealed, err := encryptor.Seal(sealed, sealed[:NonceSize], l.encoded, nil)
+	if err != nil {
+		return dst, fmt.Errorf("failed to encrypt labels: %w", err)
+	}
+	dst = append(dst, '"')
+	dst = appendBase64(dst, sealed)
+	return append(dst, '"'), nil
+}
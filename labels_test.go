@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// testLabels returns labels for tests, failing the test on invalid configuration
+func testLabels(t *testing.T, static string, encrypt bool) *Labels {
+	t.Helper()
+	labels, err := NewLabels(LabelConfig{Static: static, Encrypt: encrypt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return labels
+}
+
+func TestLabelsRoundTrip(t *testing.T) {
+	encryptor := testEncryptor(t)
+	tests := []struct {
+		name     string
+		metadata Metadata
+		labels   *Labels
+		wantH    string // Clear text h field, empty for encrypted labels
+	}{
+		{"labels without metadata", nil, testLabels(t, "cluster=prod,zone=eu-1", false), `{"cluster":"prod","zone":"eu-1"}`},
+		{"labels with metadata", Metadata{"pid": "42", "uid": "0"}, testLabels(t, "cluster=prod", false), `{"cluster":"prod"}`},
+		{"encrypted labels", Metadata{"pid": "42"}, testLabels(t, "cluster=prod", true), ""},
+		{"encrypted labels without metadata", nil, testLabels(t, "cluster=prod", true), ""},
+		{
+			"labels needing escapes",
+			Metadata{"tls_client_cn": "büro <db> & co"},
+			testLabels(t, "zone=<eu & us>,site=Zürich,quote=\"x\"", false),
+			`{"quote":"\"x\"","site":"Zürich","zone":"\u003ceu \u0026 us\u003e"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := testMessage()
+			msg.Metadata = tt.metadata
+			record, err := appendRecord(nil, encryptor, msg, "", tt.labels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			message, err := openRecord(encryptor, record)
+			if err != nil {
+				t.Fatalf("decrypting %s: %v", record, err)
+			}
+			if message != string(msg.Data) {
+				t.Errorf("decrypted %q, want %q", message, msg.Data)
+			}
+
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(record, &fields); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := fields["a"]; ok != (tt.metadata != nil) {
+				t.Errorf("record %s: a field present = %v", record, ok)
+			}
+			if tt.wantH != "" && string(fields["h"]) != tt.wantH {
+				t.Errorf("h = %s, want %s", fields["h"], tt.wantH)
+			}
+			if tt.wantH == "" && (len(fields["h"]) == 0 || fields["h"][0] != '"') {
+				t.Errorf("h = %s, want encrypted labels", fields["h"])
+			}
+		})
+	}
+}
+
+func TestLabelsTampering(t *testing.T) {
+	encryptor := testEncryptor(t)
+	msg := testMessage()
+	clear, err := appendRecord(nil, encryptor, msg, "", testLabels(t, "cluster=prod", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := appendRecord(nil, encryptor, msg, "", testLabels(t, "cluster=prod", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := appendRecord(nil, encryptor, msg, "", testLabels(t, "cluster=dev", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlabeled, err := appendRecord(nil, encryptor, msg, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var otherFields map[string]json.RawMessage
+	if err := json.Unmarshal(other, &otherFields); err != nil {
+		t.Fatal(err)
+	}
+
+	// Changing the labels or the metadata of a record must fail authentication
+	tamper := func(record []byte, field string, value json.RawMessage) []byte {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(record, &fields); err != nil {
+			t.Fatal(err)
+		}
+		if value == nil {
+			delete(fields, field)
+		} else {
+			fields[field] = value
+		}
+		tampered, err := json.Marshal(fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tampered
+	}
+	tests := []struct {
+		name   string
+		record []byte
+	}{
+		{"changed label value", tamper(clear, "h", json.RawMessage(`{"cluster":"dev"}`))},
+		{"added label", tamper(clear, "h", json.RawMessage(`{"cluster":"prod","zone":"eu"}`))},
+		{"removed labels", tamper(clear, "h", nil)},
+		{"labels added to a record without", tamper(unlabeled, "h", json.RawMessage(`{"cluster":"prod"}`))},
+		{"encrypted labels swapped", tamper(encrypted, "h", otherFields["h"])},
+		{"encrypted labels made clear", tamper(encrypted, "h", json.RawMessage(`{"cluster":"prod"}`))},
+		{"changed metadata", tamper(clear, "a", json.RawMessage(`{"gid":"0","pid":"1","uid":"0"}`))},
+	}
+	for _, tt := range tests {
+		if _, err := openRecord(encryptor, tt.record); err == nil {
+			t.Errorf("%s: tampered record decrypted", tt.name)
+		}
+	}
+
+	// The untouched records still decrypt
+	for _, record := range [][]byte{clear, encrypted, other, unlabeled} {
+		if _, err := openRecord(encryptor, record); err != nil {
+			t.Errorf("untouched record: %v", err)
+		}
+	}
+}
@@ -0,0 +1,620 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// ListenerConfig describes one listener from the LISTENERS environment variable
+// (or from the single-listener variables such as SOCKET_PATH and TCP_ADDR)
+type ListenerConfig struct {
+	Name    string `json:"name"`    // Label for logs, metrics and the "l" output field
+	Type    string `json:"type"`    // "unix", "unix_stream", "tcp", "tls", "udp", "file", "cri" or "journal"
+	Address string `json:"address"` // Socket path or host:port (empty with an inherited socket)
+	Tag     string `json:"tag"`     // Routing tag matched by route "listener" rules (default: name)
+
+	// Inherited socket selection (see activation.go)
+	FDName string `json:"fd_name"` // LISTEN_FDNAMES entry
+	FD     *int   `json:"fd"`      // Inherited file descriptor number
+
+	// Parser options (default: SYSLOG_FORMAT and SYSLOG_METADATA_FIELDS)
+	SyslogFormat   string   `json:"syslog_format"`
+	MetadataFields []string `json:"metadata_fields"`
+
+	// Files to follow and their read offsets (file, cri)
+	Paths          []string `json:"paths"`
+	CheckpointFile string   `json:"checkpoint_file"`
+	PollInterval   string   `json:"poll_interval"`
+	StartAt        string   `json:"start_at"`
+
+	// Stream listeners (tcp, tls, unix_stream) and framing of files
+	Framing             string `json:"framing"`
+	Delimiter           string `json:"delimiter"`
+	MaxConnections      *int   `json:"max_connections"`
+	MaxConnectionsPerIP int    `json:"max_connections_per_ip"`
+	IdleTimeout         string `json:"idle_timeout"`
+	MaxFrameSize        int    `json:"max_frame_size"`
+
+	// Maximum message size and oversize policy (truncate, split, drop)
+	MaxMessageSize *int   `json:"max_message_size"`
+	OversizePolicy string `json:"oversize_policy"`
+
+	// Per-sender token bucket (default: RATE_LIMIT, RATE_BURST, RATE_LIMIT_BY)
+	RateLimit           *float64 `json:"rate_limit"`
+	RateBurst           int      `json:"rate_burst"`
+	RateLimitBy         string   `json:"rate_limit_by"`
+	RateSummaryInterval string   `json:"rate_summary_interval"`
+
+	// Socket file mode and ownership (unix, unix_stream, journal)
+	Mode  string `json:"mode"`
+	Owner string `json:"owner"`
+	Group string `json:"group"`
+
+	// Unix datagram sender credentials
+	Credentials    *bool  `json:"credentials"`
+	CredentialsExe bool   `json:"credentials_exe"`
+	AllowedUIDs    string `json:"allowed_uids"`
+
+	// Kernel receive buffer and drop accounting (unix, udp, journal)
+	ReadBuffer    int    `json:"read_buffer"`
+	StatsInterval string `json:"stats_interval"`
+
+	// TLS
+	CertFile       string   `json:"cert_file"`
+	KeyFile        string   `json:"key_file"`
+	ClientCAFile   string   `json:"client_ca_file"`
+	AllowedClients []string `json:"allowed_clients"`
+	ReloadInterval string   `json:"reload_interval"`
+
+	autoClaim bool             // Take the first unclaimed activated socket of this type
+	optional  bool             // Only start with an address or an inherited socket
+	inherited *InheritedSocket // Pre-opened socket, used instead of Address
+}
+
+// Listener is a configured syslog server feeding the shared pipeline
+type Listener struct {
+	Name    string
+	run     func() error
+	cleanup func()
+}
+
+// Run serves the listener until it is closed
+func (l *Listener) Run() error {
+	return l.run()
+}
+
+// Cleanup closes the listener and removes its socket file
+func (l *Listener) Cleanup() {
+	l.cleanup()
+}
+
+// ParseListenerConfigs decodes the JSON array from the LISTENERS environment variable
+func ParseListenerConfigs(raw string) ([]*ListenerConfig, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var configs []*ListenerConfig
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		return nil, fmt.Errorf("invalid LISTENERS JSON: %w", err)
+	}
+	for i, cfg := range configs {
+		if cfg.Name == "" {
+			cfg.Name = fmt.Sprintf("%s%d", cfg.Type, i+1)
+		}
+		if _, ok := listenerSocketKinds[cfg.Type]; !ok {
+			return nil, fmt.Errorf("listener %s: unknown type %q (expected unix, unix_stream, tcp, tls, udp, file, cri or journal)", cfg.Name, cfg.Type)
+		}
+		// A socket listener without an address is served from an inherited socket
+		cfg.autoClaim = cfg.Address == "" && listenerSocketKinds[cfg.Type] != ""
+		if cfg.Type == "cri" && len(cfg.Paths) == 0 {
+			cfg.Paths = []string{criPodLogPaths}
+		}
+	}
+	return configs, nil
+}
+
+// LoadListenerConfigs returns the LISTENERS entries followed by the single-listener
+// entries. LISTENERS comes first so its listeners take activated sockets of their type
+// before the single-listener variables do.
+func LoadListenerConfigs(raw string) ([]*ListenerConfig, error) {
+	configs, err := ParseListenerConfigs(raw)
+	if err != nil {
+		return nil, err
+	}
+	return append(configs, legacyListenerConfigs()...), nil
+}
+
+// listenerSocketKinds maps listener types to the inherited socket kind they accept
+var listenerSocketKinds = map[string]string{
+	"unix":        "unix",
+	"unix_stream": "unix_stream",
+	"tcp":         "tcp",
+	"tls":         "tcp",
+	"udp":         "udp",
+	"file":        "",
+	"cri":         "",
+	"journal":     "unix",
+}
+
+// legacyListenerConfigs builds one listener of each type from the single-listener
+// environment variables, named after the type
+func legacyListenerConfigs() []*ListenerConfig {
+	inheritedFD := func(prefix string) *int {
+		if fd := getEnvInt(prefix+"_FD", -1); fd >= 0 {
+			return &fd
+		}
+		return nil
+	}
+
+	// TLS shares the TCP framing and connection limits
+	tcpMaxConnections := getEnvInt("TCP_MAX_CONNECTIONS", 1000)
+	tcp := ListenerConfig{
+		Framing:             os.Getenv("TCP_FRAMING"),
+		MaxConnections:      &tcpMaxConnections,
+		MaxConnectionsPerIP: getEnvInt("TCP_MAX_CONNECTIONS_PER_IP", 0),
+		IdleTimeout:         os.Getenv("TCP_IDLE_TIMEOUT"),
+		MaxFrameSize:        getEnvInt("TCP_MAX_FRAME_SIZE", 0),
+	}
+
+	// TLS can only be selected by name so it never takes the TCP listener's socket
+	tls := tcp
+	tls.Name = "tls"
+	tls.Type = "tls"
+	tls.Address = os.Getenv("TLS_ADDR")
+	tls.FDName = os.Getenv("TLS_FDNAME")
+	tls.FD = inheritedFD("TLS")
+	tls.SyslogFormat = os.Getenv("TLS_SYSLOG_FORMAT")
+	tls.CertFile = os.Getenv("TLS_CERT_FILE")
+	tls.KeyFile = os.Getenv("TLS_KEY_FILE")
+	tls.ClientCAFile = os.Getenv("TLS_CLIENT_CA_FILE")
+	tls.AllowedClients = splitList(os.Getenv("TLS_ALLOWED_CLIENTS"))
+	tls.ReloadInterval = os.Getenv("TLS_RELOAD_INTERVAL")
+
+	tcp.Name = "tcp"
+	tcp.Type = "tcp"
+	tcp.Address = os.Getenv("TCP_ADDR")
+	tcp.FDName = os.Getenv("TCP_FDNAME")
+	tcp.FD = inheritedFD("TCP")
+	tcp.SyslogFormat = os.Getenv("TCP_SYSLOG_FORMAT")
+	tcp.autoClaim = true
+
+	udp := ListenerConfig{
+		Name:         "udp",
+		Type:         "udp",
+		Address:      os.Getenv("UDP_ADDR"),
+		FDName:       os.Getenv("UDP_FDNAME"),
+		FD:           inheritedFD("UDP"),
+		SyslogFormat: os.Getenv("UDP_SYSLOG_FORMAT"),
+		ReadBuffer:   getEnvInt("UDP_READ_BUFFER", 0),
+		autoClaim:    true,
+	}
+
+	unixStreamMaxConnections := getEnvInt("UNIX_STREAM_MAX_CONNECTIONS", 1000)
+	unixStream := ListenerConfig{
+		Name:           "unix_stream",
+		Type:           "unix_stream",
+		Address:        os.Getenv("UNIX_STREAM_PATH"),
+		FDName:         os.Getenv("UNIX_STREAM_FDNAME"),
+		FD:             inheritedFD("UNIX_STREAM"),
+		SyslogFormat:   os.Getenv("UNIX_STREAM_SYSLOG_FORMAT"),
+		Framing:        os.Getenv("UNIX_STREAM_FRAMING"),
+		Delimiter:      os.Getenv("UNIX_STREAM_DELIMITER"),
+		MaxConnections: &unixStreamMaxConnections,
+		IdleTimeout:    os.Getenv("UNIX_STREAM_IDLE_TIMEOUT"),
+		MaxFrameSize:   getEnvInt("UNIX_STREAM_MAX_FRAME_SIZE", 0),
+		Mode:           os.Getenv("UNIX_STREAM_MODE"),
+		Owner:          os.Getenv("UNIX_STREAM_OWNER"),
+		Group:          os.Getenv("UNIX_STREAM_GROUP"),
+		autoClaim:      true,
+	}
+
+	credentials := getEnvBool("SOCKET_CREDENTIALS", credentialsSupported)
+	unix := ListenerConfig{
+		Name:           "unix",
+		Type:           "unix",
+		Address:        os.Getenv("SOCKET_PATH"),
+		FDName:         os.Getenv("SOCKET_FDNAME"),
+		FD:             inheritedFD("SOCKET"),
+		SyslogFormat:   os.Getenv("SOCKET_SYSLOG_FORMAT"),
+		Mode:           os.Getenv("SOCKET_MODE"),
+		Owner:          os.Getenv("SOCKET_OWNER"),
+		Group:          os.Getenv("SOCKET_GROUP"),
+		Credentials:    &credentials,
+		CredentialsExe: getEnvBool("SOCKET_CREDENTIALS_EXE", false),
+		AllowedUIDs:    os.Getenv("SOCKET_ALLOWED_UIDS"),
+		ReadBuffer:     getEnvInt("SOCKET_READ_BUFFER", 0),
+		autoClaim:      true,
+	}
+
+	file := ListenerConfig{
+		Name:           "file",
+		Type:           "file",
+		Paths:          splitList(os.Getenv("FILE_PATHS")),
+		CheckpointFile: os.Getenv("FILE_CHECKPOINT"),
+		PollInterval:   os.Getenv("FILE_POLL_INTERVAL"),
+		StartAt:        os.Getenv("FILE_START_AT"),
+		SyslogFormat:   os.Getenv("FILE_SYSLOG_FORMAT"),
+		Framing:        os.Getenv("FILE_FRAMING"),
+		Delimiter:      os.Getenv("FILE_DELIMITER"),
+	}
+
+	cri := ListenerConfig{
+		Name:           "cri",
+		Type:           "cri",
+		Paths:          splitList(os.Getenv("CRI_PATHS")),
+		CheckpointFile: os.Getenv("CRI_CHECKPOINT"),
+		PollInterval:   os.Getenv("CRI_POLL_INTERVAL"),
+		StartAt:        os.Getenv("CRI_START_AT"),
+		SyslogFormat:   os.Getenv("CRI_SYSLOG_FORMAT"),
+	}
+
+	// The journal socket is only taken from inherited sockets by name
+	journal := ListenerConfig{
+		Name:       "journal",
+		Type:       "journal",
+		Address:    os.Getenv("JOURNAL_SOCKET_PATH"),
+		FDName:     os.Getenv("JOURNAL_FDNAME"),
+		FD:         inheritedFD("JOURNAL"),
+		Mode:       os.Getenv("JOURNAL_SOCKET_MODE"),
+		ReadBuffer: getEnvInt("JOURNAL_READ_BUFFER", 0),
+	}
+
+	configs := []*ListenerConfig{&tls, &tcp, &udp, &unixStream, &unix, &file, &cri, &journal}
+	for _, cfg := range configs {
+		cfg.optional = true
+	}
+	return configs
+}
+
+// ResolveListeners assigns inherited sockets to listeners and drops single-listener
+// entries that have neither an address nor a socket. Explicit fd_name/fd selections
+// are claimed before any listener takes the first unclaimed socket of its type.
+func ResolveListeners(configs []*ListenerConfig, inherited *InheritedSockets) ([]*ListenerConfig, error) {
+	for _, explicit := range []bool{true, false} {
+		for _, cfg := range configs {
+			if (cfg.FDName != "" || cfg.FD != nil) != explicit {
+				continue
+			}
+			fd := -1
+			if cfg.FD != nil {
+				fd = *cfg.FD
+			}
+			socket, err := inherited.Claim(cfg.FDName, fd, listenerSocketKinds[cfg.Type], cfg.autoClaim)
+			if err != nil {
+				return nil, fmt.Errorf("listener %s: %w", cfg.Name, err)
+			}
+			cfg.inherited = socket
+		}
+	}
+
+	var resolved []*ListenerConfig
+	names := make(map[string]bool)
+	for _, cfg := range configs {
+		if cfg.Type == "file" || cfg.Type == "cri" {
+			if len(cfg.Paths) == 0 {
+				if cfg.optional {
+					continue
+				}
+				return nil, fmt.Errorf("listener %s: paths is required", cfg.Name)
+			}
+		} else if cfg.Address == "" && cfg.inherited == nil {
+			if cfg.optional {
+				continue
+			}
+			return nil, fmt.Errorf("listener %s: address is required without an inherited socket", cfg.Name)
+		}
+		// Names label metrics and output records, so they must be unique
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("duplicate listener name %q", cfg.Name)
+		}
+		names[cfg.Name] = true
+		resolved = append(resolved, cfg)
+	}
+	return resolved, nil
+}
+
+// checkRateLimitKey rejects sender keys the listener's messages never carry, which
+// would put every sender in one bucket
+func (cfg *ListenerConfig) checkRateLimitKey(by string) error {
+	switch by {
+	case "pid", "uid":
+		credentials := credentialsSupported
+		if cfg.Credentials != nil {
+			credentials = *cfg.Credentials
+		}
+		if (cfg.Type != "unix" && cfg.Type != "journal") || !credentials {
+			return fmt.Errorf("rate limit key %q requires a unix or journal listener with socket credentials", by)
+		}
+	case "remote_ip":
+		if cfg.Type != "tcp" && cfg.Type != "tls" && cfg.Type != "udp" {
+			return fmt.Errorf("rate limit key %q requires a tcp, tls or udp listener", by)
+		}
+	case "container":
+		if cfg.Type != "cri" {
+			return fmt.Errorf("rate limit key %q requires a cri listener", by)
+		}
+	}
+	return nil
+}
+
+// NewListener creates the server for a listener config
+func NewListener(cfg *ListenerConfig, pipeline *Pipeline, multilineRules []*MultilineRule) (*Listener, error) {
+	// Files, like stdin, often hold plain application logs rather than syslog
+	defaultFormat := "auto"
+	if cfg.Type == "file" || cfg.Type == "cri" {
+		defaultFormat = "none"
+	}
+	if cfg.Type == "journal" || cfg.Framing == "journal" || cfg.Framing == "export" {
+		defaultFormat = "journal"
+	}
+	source, err := NewSource(cfg.Name, cfg.Tag, cfg.SyslogFormat, cfg.MetadataFields, defaultFormat)
+	if err != nil {
+		return nil, fmt.Errorf("listener %s: %w", cfg.Name, err)
+	}
+	if source.Limit, err = NewMessageLimit(cfg.MaxMessageSize, cfg.OversizePolicy); err != nil {
+		return nil, fmt.Errorf("listener %s: %w", cfg.Name, err)
+	}
+	rateLimit, err := NewRateLimitConfig(cfg.RateLimit, cfg.RateBurst, cfg.RateLimitBy, cfg.RateSummaryInterval)
+	if err == nil && rateLimit.Rate > 0 {
+		err = cfg.checkRateLimitKey(rateLimit.By)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listener %s: %w", cfg.Name, err)
+	}
+	source.Multiline = MultilineRulesFor(multilineRules, source.Tag)
+	logMultilineRules(cfg.Name, source.Multiline)
+	l := &Listener{Name: cfg.Name}
+	inherited := cfg.inherited
+
+	switch cfg.Type {
+	case "unix", "journal":
+		statsInterval, err := cfg.statsInterval()
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", cfg.Name, err)
+		}
+		permissions, err := ParseSocketPermissions(cfg.Mode, cfg.Owner, cfg.Group, 0666)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: invalid socket permissions: %w", cfg.Name, err)
+		}
+		allowedUIDs, err := ParseUIDList(cfg.AllowedUIDs)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: invalid allowed_uids: %w", cfg.Name, err)
+		}
+		config := UnixSocketConfig{
+			Permissions:    permissions,
+			Credentials:    credentialsSupported,
+			CredentialsExe: cfg.CredentialsExe,
+			AllowedUIDs:    allowedUIDs,
+			ReadBuffer:     cfg.ReadBuffer,
+			StatsInterval:  statsInterval,
+			Journal:        cfg.Type == "journal",
+		}
+		if cfg.Credentials != nil {
+			config.Credentials = *cfg.Credentials
+		}
+		if allowedUIDs != nil && !config.Credentials {
+			return nil, fmt.Errorf("listener %s: allowed_uids requires credentials (Linux only)", cfg.Name)
+		}
+		server := NewUnixSyslogServer(cfg.Address, pipeline, source, config)
+		l.cleanup = server.Cleanup
+		l.run = server.Start
+		if inherited != nil {
+			l.run = func() error { return server.ServeInherited(inherited.PacketConn.(*net.UnixConn)) }
+		}
+
+	case "udp":
+		statsInterval, err := cfg.statsInterval()
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", cfg.Name, err)
+		}
+		server := NewUDPSyslogServer(cfg.Address, pipeline, source, cfg.ReadBuffer, statsInterval)
+		l.cleanup = server.Cleanup
+		l.run = server.Start
+		if inherited != nil {
+			l.run = func() error { return server.Serve(inherited.PacketConn.(*net.UDPConn)) }
+		}
+
+	case "file", "cri":
+		config, err := cfg.fileTailConfig()
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", cfg.Name, err)
+		}
+		if config.CheckpointFile == "" {
+			log.Printf("Warning: listener %s has no checkpoint_file; files are read again from start_at after a restart", cfg.Name)
+		}
+		tailer := NewFileTailer(pipeline, source, config)
+		l.cleanup = tailer.Cleanup
+		l.run = tailer.Start
+
+	case "tcp", "tls", "unix_stream":
+		config, err := cfg.streamConfig()
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", cfg.Name, err)
+		}
+		var server *StreamSyslogServer
+		switch cfg.Type {
+		case "tcp":
+			server = NewTCPSyslogServer(cfg.Address, pipeline, source, config)
+		case "tls":
+			reloader, err := cfg.certReloader()
+			if err != nil {
+				return nil, fmt.Errorf("listener %s: %w", cfg.Name, err)
+			}
+			server = NewTLSSyslogServer(cfg.Address, pipeline, source, config, reloader)
+		case "unix_stream":
+			permissions, err := ParseSocketPermissions(cfg.Mode, cfg.Owner, cfg.Group, 0666)
+			if err != nil {
+				return nil, fmt.Errorf("listener %s: invalid socket permissions: %w", cfg.Name, err)
+			}
+			server = NewUnixStreamSyslogServer(cfg.Address, pipeline, source, config, permissions)
+		}
+		l.cleanup = server.Cleanup
+		l.run = server.Start
+		if inherited != nil {
+			l.run = func() error { return server.ServeInherited(inherited.Listener) }
+		}
+
+	default:
+		return nil, fmt.Errorf("listener %s: unknown type %q", cfg.Name, cfg.Type)
+	}
+
+	// Summaries of suppressed messages are emitted until the listener is closed
+	if source.RateLimit = pipeline.NewRateLimiter(source, rateLimit); source.RateLimit != nil {
+		cleanup := l.cleanup
+		l.cleanup = func() {
+			cleanup()
+			source.RateLimit.Stop()
+		}
+	}
+
+	where := cfg.Address
+	if inherited != nil {
+		where = fmt.Sprintf("inherited socket %q", inherited.Name)
+	} else if cfg.Type == "file" || cfg.Type == "cri" {
+		where = strings.Join(cfg.Paths, ",")
+	}
+	log.Printf("Listener %s: type=%s address=%s format=%s tag=%q", cfg.Name, cfg.Type, where, source.SyslogFormat, source.Tag)
+	return l, nil
+}
+
+// streamConfig returns the framing and connection limits of a stream listener
+func (cfg *ListenerConfig) streamConfig() (StreamConfig, error) {
+	// Default to auto-detecting octet-counted and delimited frames
+	framingName := cfg.Framing
+	if framingName == "" {
+		framingName = "auto"
+	}
+	framing, err := ParseFraming(framingName)
+	if err != nil {
+		return StreamConfig{}, fmt.Errorf("invalid framing: %w", err)
+	}
+	delimiter, err := ParseDelimiter(cfg.Delimiter)
+	if err != nil {
+		return StreamConfig{}, fmt.Errorf("invalid delimiter: %w", err)
+	}
+
+	// Network peers that go silent are disconnected; local Unix clients may idle indefinitely
+	idleTimeout := 5 * time.Minute
+	if cfg.Type == "unix_stream" {
+		idleTimeout = 0
+	}
+	if cfg.IdleTimeout != "" {
+		if idleTimeout, err = time.ParseDuration(cfg.IdleTimeout); err != nil || idleTimeout < 0 {
+			return StreamConfig{}, fmt.Errorf("invalid idle_timeout %q: must be a non-negative duration (e.g. 30s, 5m)", cfg.IdleTimeout)
+		}
+	}
+
+	config := StreamConfig{
+		Framing:           framing,
+		Delimiter:         delimiter,
+		MaxConnections:    1000,
+		MaxConnectionsPer: cfg.MaxConnectionsPerIP,
+		IdleTimeout:       idleTimeout,
+		MaxFrameSize:      cfg.MaxFrameSize,
+	}
+	if cfg.MaxConnections != nil {
+		config.MaxConnections = *cfg.MaxConnections
+	}
+	if config.MaxFrameSize <= 0 {
+		config.MaxFrameSize = 65536
+	}
+	return config, nil
+}
+
+// fileTailConfig returns the framing, polling and checkpoint options of a file listener
+func (cfg *ListenerConfig) fileTailConfig() (FileTailConfig, error) {
+	framing, err := ParseFraming(cfg.Framing)
+	if err != nil {
+		return FileTailConfig{}, fmt.Errorf("invalid framing: %w", err)
+	}
+	if framing == FramingWhole {
+		return FileTailConfig{}, fmt.Errorf("invalid framing: whole is not supported for followed files")
+	}
+	if cfg.Type == "cri" && (framing != FramingDelimiter || cfg.Delimiter != "") {
+		return FileTailConfig{}, fmt.Errorf("framing and delimiter cannot be set for CRI container logs")
+	}
+	delimiter, err := ParseDelimiter(cfg.Delimiter)
+	if err != nil {
+		return FileTailConfig{}, fmt.Errorf("invalid delimiter: %w", err)
+	}
+
+	pollInterval := time.Second
+	if cfg.PollInterval != "" {
+		if pollInterval, err = time.ParseDuration(cfg.PollInterval); err != nil || pollInterval <= 0 {
+			return FileTailConfig{}, fmt.Errorf("invalid poll_interval %q: must be a positive duration (e.g. 250ms, 1s)", cfg.PollInterval)
+		}
+	}
+
+	var fromEnd bool
+	switch cfg.StartAt {
+	case "", "beginning":
+	case "end":
+		fromEnd = true
+	default:
+		return FileTailConfig{}, fmt.Errorf("invalid start_at %q (expected beginning or end)", cfg.StartAt)
+	}
+
+	maxFrameSize := cfg.MaxFrameSize
+	if maxFrameSize == 0 {
+		maxFrameSize = 65536
+	}
+	return FileTailConfig{
+		Paths:          cfg.Paths,
+		CheckpointFile: cfg.CheckpointFile,
+		PollInterval:   pollInterval,
+		FromEnd:        fromEnd,
+		Framing:        framing,
+		Delimiter:      delimiter,
+		TrimCR:         cfg.Delimiter == "crlf",
+		MaxFrameSize:   maxFrameSize,
+		CRI:            cfg.Type == "cri",
+	}, nil
+}
+
+// statsInterval returns how often a datagram listener exports its kernel receive
+// queue and drop counters, defaulting to SOCKET_STATS_INTERVAL
+func (cfg *ListenerConfig) statsInterval() (time.Duration, error) {
+	if cfg.StatsInterval == "" {
+		return getEnvDuration("SOCKET_STATS_INTERVAL", 10*time.Second), nil
+	}
+	interval, err := time.ParseDuration(cfg.StatsInterval)
+	if err != nil || interval < 0 {
+		return 0, fmt.Errorf("invalid stats_interval %q: must be a non-negative duration (e.g. 10s, 1m)", cfg.StatsInterval)
+	}
+	return interval, nil
+}
+
+// certReloader loads the certificates of a TLS listener
+func (cfg *ListenerConfig) certReloader() (*CertReloader, error) {
+	files := TLSFiles{
+		CertFile:       cfg.CertFile,
+		KeyFile:        cfg.KeyFile,
+		ClientCAFile:   cfg.ClientCAFile,
+		AllowedClients: cfg.AllowedClients,
+		ReloadInterval: time.Minute,
+	}
+	if cfg.ReloadInterval != "" {
+		interval, err := time.ParseDuration(cfg.ReloadInterval)
+		if err != nil || interval < 0 {
+			return nil, fmt.Errorf("invalid reload_interval %q: must be a non-negative duration (e.g. 30s, 5m)", cfg.ReloadInterval)
+		}
+		files.ReloadInterval = interval
+	}
+	if files.CertFile == "" || files.KeyFile == "" {
+		return nil, fmt.Errorf("cert_file and key_file (TLS_CERT_FILE and TLS_KEY_FILE) are required")
+	}
+	if len(files.AllowedClients) > 0 && files.ClientCAFile == "" {
+		return nil, fmt.Errorf("allowed_clients requires client_ca_file")
+	}
+	reloader, err := NewCertReloader(files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificates: %w", err)
+	}
+	log.Printf("TLS listener certificates loaded (mutual TLS: %t)", files.ClientCAFile != "")
+	return reloader, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -8,24 +9,29 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
-type EncryptedLogEntry struct {
-	Timestamp     string `json:"t"`
-	Nonce         string `json:"n"`
-	EncryptedData string `json:"m"`
+// Metadata holds clear-text attributes that are authenticated (but not encrypted)
+// together with the message, such as the TLS client identity
+type Metadata map[string]string
+
+// Encode returns the canonical JSON encoding (sorted keys) used as AES-GCM additional data
+func (m Metadata) Encode() ([]byte, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(map[string]string(m))
 }
 
 func main() {
 	// Set log output to stderr to keep stdout clean for JSON
 	log.SetOutput(os.Stderr)
 	
-	// Support Unix socket for direct syslog integration (required unless STDIN_MODE)
-	socketPath := os.Getenv("SOCKET_PATH")
-	
 	// Support stdin processing mode (only if explicitly configured)
 	stdinMode := os.Getenv("STDIN_MODE") != ""
 	
@@ -83,20 +89,92 @@ func main() {
 	log.Printf("Encryptor public key: %x", encryptor.GetPublicKey())
 	log.Printf("Decryptor public key: %x", decryptorPublicKey)
 
+	// Build recipient routing (unmatched messages use DECRYPTOR_PUBLIC_KEY and OUTPUT)
+	routeConfigs, err := ParseRouteConfigs(os.Getenv("ROUTES"))
+	if err != nil {
+		log.Fatalf("Invalid routing configuration: %v", err)
+	}
+	// Filter rules drop unwanted messages (e.g. health checks) before encryption
+	filterConfigs, err := ParseFilterConfigs(os.Getenv("FILTERS"))
+	if err != nil {
+		log.Fatalf("Invalid filter configuration: %v", err)
+	}
+	filters, err := NewFilterRules(filterConfigs)
+	if err != nil {
+		log.Fatalf("Invalid filter configuration: %v", err)
+	}
+	// Secrets are replaced before encryption so they are never stored, even encrypted
+	redactPatterns, err := ParseRedactPatternConfigs(os.Getenv("REDACT_PATTERNS"))
+	if err != nil {
+		log.Fatalf("Invalid redaction configuration: %v", err)
+	}
+	redactor, err := NewRedactor(RedactConfig{
+		Builtin:  splitList(os.Getenv("REDACT_BUILTIN")),
+		Patterns: redactPatterns,
+		Mode:     os.Getenv("REDACT_MODE"),
+		Marker:   os.Getenv("REDACT_MARKER"),
+		HashKey:  os.Getenv("REDACT_HASH_KEY"),
+	})
+	if err != nil {
+		log.Fatalf("Invalid redaction configuration: %v", err)
+	}
+	// Labels identify this host or pod in every record, authenticated with the message
+	labels, err := NewLabels(LabelConfig{
+		Static:   os.Getenv("LABELS"),
+		FromEnv:  os.Getenv("LABELS_FROM_ENV"),
+		FromFile: os.Getenv("LABELS_FROM_FILE"),
+		Hostname: os.Getenv("LABEL_HOSTNAME"),
+		Encrypt:  getEnvBool("LABELS_ENCRYPT", false),
+	})
+	if err != nil {
+		log.Fatalf("Invalid label configuration: %v", err)
+	}
+	// Records are batched into large writes; the flush interval bounds their delay
+	outputConfig := OutputConfig{
+		Default:       os.Getenv("OUTPUT"),
+		BufferSize:    getEnvInt("OUTPUT_BUFFER_SIZE", 65536),
+		FlushInterval: getEnvDuration("OUTPUT_FLUSH_INTERVAL", 100*time.Millisecond),
+	}
+	router, err := NewRouter(encryptorPrivateKey, encryptor, routeConfigs, filters, redactor, labels, outputConfig)
+	if err != nil {
+		log.Fatalf("Failed to create router: %v", err)
+	}
+
+	// Multiline reassembly rules, selected per listener by routing tag
+	multilineConfigs, err := ParseMultilineConfigs(os.Getenv("MULTILINE"))
+	if err != nil {
+		log.Fatalf("Invalid multiline configuration: %v", err)
+	}
+	multilineRules, err := NewMultilineRules(multilineConfigs)
+	if err != nil {
+		log.Fatalf("Invalid multiline configuration: %v", err)
+	}
+
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	
-	var unixServer *UnixSyslogServer
+	var listeners []*Listener
+	var pipeline *Pipeline
 	var shutdownOnce sync.Once
 	
+	// shutdown stops the listeners (flushing their pending messages and rate limit
+	// summaries), then writes every queued record before the outputs close
+	shutdown := func() {
+		for _, listener := range listeners {
+			listener.Cleanup()
+		}
+		if pipeline != nil {
+			pipeline.Close()
+		}
+		router.Close()
+	}
+
 	go func() {
 		<-sigChan
 		shutdownOnce.Do(func() {
 			log.Println("Shutting down gracefully...")
-			if unixServer != nil {
-				unixServer.Cleanup()
-			}
+			shutdown()
 			log.Println("Cleanup completed, exiting...")
 			os.Exit(0)
 		})
@@ -105,9 +183,27 @@ func main() {
 	// Handle stdin mode first - ignore all other configuration
 	if stdinMode {
 		log.Printf("Starting stdin processing mode...")
-		if err := processStdinSimple(encryptor); err != nil {
+		stdinConfig, err := ParseStdinConfig(os.Getenv("STDIN_FRAMING"), os.Getenv("STDIN_DELIMITER"), getEnvInt("STDIN_MAX_FRAME_SIZE", 65536))
+		if err != nil {
+			log.Fatalf("Invalid stdin framing configuration: %v", err)
+		}
+		// Journal entries carry their priority and identifier as fields
+		defaultFormat := "none"
+		if stdinConfig.Framing == FramingJournal {
+			defaultFormat = "journal"
+		}
+		stdinSource, err := NewSource("stdin", "", os.Getenv("STDIN_SYSLOG_FORMAT"), nil, defaultFormat)
+		if err != nil {
+			log.Fatalf("Invalid stdin parser configuration: %v", err)
+		}
+		if stdinSource.Limit, err = stdinMessageLimit(stdinConfig); err != nil {
+			log.Fatalf("Invalid stdin message size limit: %v", err)
+		}
+		stdinSource.Multiline = MultilineRulesFor(multilineRules, stdinSource.Tag)
+		if err := processStdinSimple(router, stdinSource, stdinConfig, os.Stdin); err != nil {
 			log.Fatalf("Stdin processing failed: %v", err)
 		}
+		router.Close()
 		return
 	}
 
@@ -126,23 +222,139 @@ func main() {
 		}()
 	}
 
-	// Validate that socket path is configured for server mode
-	if socketPath == "" {
-		log.Fatal("SOCKET_PATH environment variable is required")
+	// Listeners from LISTENERS plus the single-listener variables (SOCKET_PATH, TCP_ADDR, ...)
+	listenerConfigs, err := LoadListenerConfigs(os.Getenv("LISTENERS"))
+	if err != nil {
+		log.Fatalf("Invalid listener configuration: %v", err)
+	}
+
+	// Pre-opened sockets from systemd socket activation (LISTEN_FDS) or <LISTENER>_FD
+	inheritedSockets, err := LoadInheritedSockets()
+	if err != nil {
+		log.Fatalf("Failed to load inherited sockets: %v", err)
+	}
+	listenerConfigs, err = ResolveListeners(listenerConfigs, inheritedSockets)
+	if err != nil {
+		log.Fatalf("Invalid listener configuration: %v", err)
 	}
+	inheritedSockets.CloseUnclaimed()
 
-	// Start Unix socket server
-	log.Printf("Starting Unix socket syslog server on %s", socketPath)
-	unixServer = NewUnixSyslogServer(socketPath, encryptor)
-	if err := unixServer.Start(); err != nil {
-		log.Fatalf("Unix socket server failed: %v", err)
+	// Validate that at least one listener is configured for server mode
+	if len(listenerConfigs) == 0 {
+		log.Fatal("LISTENERS, SOCKET_PATH, UNIX_STREAM_PATH, TCP_ADDR, TLS_ADDR, UDP_ADDR, FILE_PATHS, CRI_PATHS, JOURNAL_SOCKET_PATH or an inherited socket (LISTEN_FDS) is required")
 	}
+
+	// All listeners share one encryption and output pipeline: readers enqueue messages,
+	// WORKERS goroutines encrypt them and one writer outputs records in receive order
+	pipeline = NewPipeline(router, getEnvInt("WORKERS", runtime.NumCPU()), getEnvInt("QUEUE_SIZE", 1024))
+	for _, cfg := range listenerConfigs {
+		listener, err := NewListener(cfg, pipeline, multilineRules)
+		if err != nil {
+			log.Fatalf("Invalid listener configuration: %v", err)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	serverErrors := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		listener := listener
+		go func() {
+			if err := listener.Run(); err != nil {
+				serverErrors <- fmt.Errorf("listener %s failed: %w", listener.Name, err)
+			}
+		}()
+	}
+
+	err = <-serverErrors
+	shutdownOnce.Do(shutdown)
+	log.Fatal(err)
 }
 
-// processStdinSimple reads log lines from stdin and encrypts them (simple single-threaded mode)
-func processStdinSimple(encryptor *Encryptor) error {
-	parser := NewMessageParser(os.Stdin, '\n')
-	lineCount := 0
+// NewSource builds a listener's processing options. An empty format falls back to
+// SYSLOG_FORMAT and then defaultFormat; nil fields fall back to SYSLOG_METADATA_FIELDS.
+func NewSource(name, tag, formatName string, fields []string, defaultFormat string) (*Source, error) {
+	if formatName == "" {
+		formatName = os.Getenv("SYSLOG_FORMAT")
+	}
+	if formatName == "" {
+		formatName = defaultFormat
+	}
+	format, err := ParseSyslogFormat(formatName)
+	if err != nil {
+		return nil, err
+	}
+
+	if fields == nil {
+		fields = splitList(os.Getenv("SYSLOG_METADATA_FIELDS"))
+	}
+	if err := ValidateMetadataFields(fields); err != nil {
+		return nil, err
+	}
+	if len(fields) > 0 && format == SyslogFormatNone {
+		log.Printf("Warning: metadata fields have no effect on %s listener with syslog parsing disabled", name)
+	}
+
+	if tag == "" {
+		tag = name
+	}
+	return &Source{Name: name, Tag: tag, SyslogFormat: format, MetadataFields: fields}, nil
+}
+
+// StdinConfig selects how stdin is split into messages
+type StdinConfig struct {
+	Framing      Framing // Delimited (default), octet-counted, auto-detected, journal export or the whole input
+	Delimiter    byte    // Delimiter for delimited framing (LF or NUL)
+	TrimCR       bool    // Strip the CR of CRLF line endings
+	MaxFrameSize int     // Maximum octet-counted frame or journal entry size in bytes
+}
+
+// ParseStdinConfig converts the STDIN_FRAMING and STDIN_DELIMITER names to a StdinConfig
+func ParseStdinConfig(framingName, delimiterName string, maxFrameSize int) (StdinConfig, error) {
+	framing, err := ParseFraming(framingName)
+	if err != nil {
+		return StdinConfig{}, err
+	}
+	delimiter, err := ParseDelimiter(delimiterName)
+	if err != nil {
+		return StdinConfig{}, err
+	}
+	return StdinConfig{
+		Framing:      framing,
+		Delimiter:    delimiter,
+		TrimCR:       delimiterName == "crlf",
+		MaxFrameSize: maxFrameSize,
+	}, nil
+}
+
+// stdinMessageLimit returns the message size limit of stdin. The whole input is one
+// record, so whole framing is unlimited unless MAX_MESSAGE_SIZE is set.
+func stdinMessageLimit(config StdinConfig) (MessageLimit, error) {
+	if _, set := os.LookupEnv("MAX_MESSAGE_SIZE"); config.Framing == FramingWhole && !set {
+		unlimited := 0
+		return NewMessageLimit(&unlimited, "")
+	}
+	return NewMessageLimit(nil, "")
+}
+
+// processStdinSimple reads log lines from stdin and encrypts them on the calling goroutine.
+// Records completed by a multiline timeout are encrypted on the timer's goroutine.
+func processStdinSimple(router *Router, source *Source, config StdinConfig, input io.Reader) error {
+	parser := NewFramedMessageParser(input, config.Framing, config.Delimiter, config.MaxFrameSize)
+	parser.SetLimit(source.Name, source.Limit)
+	// Read by multiline timeout flushes while the reader counts
+	var lineCount atomic.Int64
+	
+	process := func(message []byte, meta Metadata) {
+		if err := router.Process(source.NewMessage(message, meta)); err != nil {
+			// Note: Continuing on encryption errors is intentional - graceful degradation
+			// is preferred over crashing. Operators can monitor logs for failures.
+			log.Printf("Failed to encrypt line %d: %v", lineCount.Load(), err)
+		}
+	}
+	// Related lines (e.g. stack traces) are combined before encryption when MULTILINE applies
+	multiline := NewMultiline(source, func(message []byte, meta Metadata, _ time.Time) {
+		process(message, meta)
+	})
 	
 	for {
 		message, err := parser.ReadMessage()
@@ -153,46 +365,47 @@ func processStdinSimple(encryptor *Encryptor) error {
 			return fmt.Errorf("error reading stdin: %w", err)
 		}
 		
+		if config.TrimCR {
+			message = bytes.TrimSuffix(message, []byte{'\r'})
+		}
+		
 		// Skip empty messages
 		if len(message) == 0 {
 			continue
 		}
 		
-		lineCount++
+		lineCount.Add(1)
 		
 		// Use consistent newline handling (strip any remaining newlines)
 		message = StripTrailingNewline(message)
 		
-		if err := encryptAndOutput(encryptor, message); err != nil {
-			// Note: Continuing on encryption errors is intentional - graceful degradation
-			// is preferred over crashing. Operators can monitor logs for failures.
-			log.Printf("Failed to encrypt line %d: %v", lineCount, err)
+		if multiline != nil {
+			multiline.Add(message, nil)
 			continue
 		}
+		process(message, nil)
+	}
+	if multiline != nil {
+		multiline.Flush()
 	}
 	
-	log.Printf("Processed %d lines from stdin", lineCount)
+	log.Printf("Processed %d lines from stdin", lineCount.Load())
 	return nil
 }
 
-// encryptAndOutput encrypts a message and outputs as JSON
-func encryptAndOutput(encryptor *Encryptor, message []byte) error {
-	encryptResult, err := encryptor.Encrypt(string(message))
+// encryptAndOutput encrypts a message and writes it as a JSON line to out.
+// Metadata and labels are bound to the ciphertext as additional data.
+func encryptAndOutput(encryptor *Encryptor, msg *LogMessage, route string, labels *Labels, out OutputSink) error {
+	buf := recordBuffers.Get().(*[]byte)
+	defer recordBuffers.Put(buf)
+
+	record, err := appendRecord((*buf)[:0], encryptor, msg, route, labels)
+	*buf = record
 	if err != nil {
-		return fmt.Errorf("failed to encrypt message: %w", err)
+		return err
 	}
-	
-	entry := EncryptedLogEntry{
-		Timestamp:     time.Now().UTC().Format(time.RFC3339Nano),
-		Nonce:         encryptResult.Nonce,
-		EncryptedData: encryptResult.EncryptedData,
+	if err := out.Write(record); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
 	}
-	
-	jsonData, err := json.Marshal(entry)
-	if err != nil {
-		return fmt.Errorf("failed to marshal JSON: %w", err)
-	}
-	
-	fmt.Println(string(jsonData))
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestProcessStdinMultilineTimeout(t *testing.T) {
+	configs, err := ParseMultilineConfigs(`[{"mode":"indent","timeout":"20ms"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := NewMultilineRules(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, path := testRouter(t)
+	source := &Source{Name: "stdin", SyslogFormat: SyslogFormatNone, Multiline: rules}
+	records := func() [][]byte {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	}
+
+	input, writer := io.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- processStdinSimple(router, source, StdinConfig{Framing: FramingDelimiter, Delimiter: '\n'}, input)
+	}()
+
+	// The first record is completed by the timeout while the reader waits for input
+	if _, err := io.WriteString(writer, "first\n  continued\n"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(records()) < 1 || len(records()[0]) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("multiline timeout did not flush the record")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// The reader keeps counting lines while the next timeout may fire
+	if _, err := io.WriteString(writer, "second\n  more\nthird\n"); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	encryptor := testEncryptor(t)
+	for _, record := range records() {
+		message, err := openRecord(encryptor, record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, message)
+	}
+	want := []string{"first\n  continued", "second\n  more", "third"}
+	if len(got) != len(want) {
+		t.Fatalf("records = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("record %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
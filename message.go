@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// LogMessage is a received message together with its source metadata
+type LogMessage struct {
+	Data     []byte         // Raw message bytes, encrypted as-is
+	Received time.Time      // When the encryptor received the message
+	Original time.Time      // Sender's timestamp known outside the message, e.g. from the container runtime
+	Metadata Metadata       // Clear-text attributes authenticated with the ciphertext
+	Syslog   *SyslogMessage // Parsed syslog fields, nil when parsing is disabled or failed
+	Source   *Source
+}
+
+// Source holds the per-listener options applied to every received message
+type Source struct {
+	Name           string           // Listener name for logs, metrics and the "l" output field
+	Tag            string           // Routing tag matched by route "listener" rules
+	SyslogFormat   SyslogFormat     // Syslog parser used for this listener
+	MetadataFields []string         // Parsed syslog fields copied into clear-text metadata
+	Limit          MessageLimit     // Maximum message size and what happens to longer messages
+	Multiline      []*MultilineRule // Reassembly rules that may apply to this listener's messages
+	RateLimit      *RateLimiter     // Per-sender token buckets (nil = unlimited)
+}
+
+// Syslog fields that may be exposed as clear-text metadata
+var syslogMetadataFields = map[string]bool{
+	"facility": true,
+	"severity": true,
+	"hostname": true,
+	"app_name": true,
+	"procid":   true,
+	"msgid":    true,
+}
+
+// ValidateMetadataFields checks a list of syslog field names for SYSLOG_METADATA_FIELDS
+func ValidateMetadataFields(fields []string) error {
+	for _, field := range fields {
+		if !syslogMetadataFields[field] {
+			return fmt.Errorf("unknown syslog metadata field %q", field)
+		}
+	}
+	return nil
+}
+
+// NewMessage wraps received bytes, parsing them with the listener's syslog format.
+// Messages that fail to parse are passed through unchanged and counted.
+func (src *Source) NewMessage(data []byte, meta Metadata) *LogMessage {
+	msg := &LogMessage{Data: data, Received: time.Now(), Metadata: meta, Source: src}
+	if src.SyslogFormat == SyslogFormatNone {
+		return msg
+	}
+
+	parsed, err := ParseSyslog(data, src.SyslogFormat)
+	if err != nil {
+		RecordParseFailure(src.Name)
+		return msg
+	}
+	msg.Syslog = parsed
+
+	for _, field := range src.MetadataFields {
+		var value string
+		switch field {
+		case "facility":
+			value = FacilityName(parsed.Facility)
+		case "severity":
+			value = severityNames[parsed.Severity]
+		case "hostname":
+			value = parsed.Hostname
+		case "app_name":
+			value = parsed.AppName
+		case "procid":
+			value = parsed.ProcID
+		case "msgid":
+			value = parsed.MsgID
+		}
+		if value != "" {
+			msg.SetMetadata(field, value)
+		}
+	}
+	return msg
+}
+
+// SetMetadata adds a clear-text attribute, copying the map so listener-wide metadata is not shared
+func (m *LogMessage) SetMetadata(key, value string) {
+	meta := make(Metadata, len(m.Metadata)+1)
+	for k, v := range m.Metadata {
+		meta[k] = v
+	}
+	meta[key] = value
+	m.Metadata = meta
+}
+
+// Parsed returns the parsed syslog fields, parsing the message on demand when its
+// listener has parsing disabled. Returns nil when the message is not syslog.
+func (m *LogMessage) Parsed() *SyslogMessage {
+	if m.Syslog != nil {
+		return m.Syslog
+	}
+	parsed, err := ParseSyslog(m.Data, SyslogFormatAuto)
+	if err != nil {
+		return nil
+	}
+	return parsed
+}
+
+// Header returns the facility and app-name used for routing and filtering,
+// parsing the message on demand when its listener has parsing disabled
+func (m *LogMessage) Header() (facility int, appName string) {
+	parsed := m.Parsed()
+	if parsed == nil {
+		return -1, ""
+	}
+	return parsed.Facility, parsed.AppName
+}
@@ -10,8 +10,26 @@ import (
 
 // Metrics holds Prometheus metrics
 type Metrics struct {
-	processedLogs  prometheus.Counter
-	processedBytes prometheus.Counter
+	processedLogs  *prometheus.CounterVec
+	processedBytes *prometheus.CounterVec
+	routedLogs     *prometheus.CounterVec
+	connections    *prometheus.GaugeVec
+	rejectedConns  *prometheus.CounterVec
+	parseFailures  *prometheus.CounterVec
+	rejectedDgrams *prometheus.CounterVec
+	queueDepth     prometheus.Gauge
+	droppedLogs    *prometheus.CounterVec
+	socketQueue    *prometheus.GaugeVec
+	socketBuffer   *prometheus.GaugeVec
+	socketDrops    *prometheus.CounterVec
+	oversizedLogs  *prometheus.CounterVec
+	multilineLines *prometheus.CounterVec
+	tailedFiles    *prometheus.GaugeVec
+	filteredLogs   *prometheus.CounterVec
+	redactions     *prometheus.CounterVec
+	rateLimited    *prometheus.CounterVec
+	rateSenders    *prometheus.GaugeVec
+	outputErrors   *prometheus.CounterVec
 }
 
 // Global metrics instance
@@ -26,29 +44,119 @@ var (
 // InitMetrics initializes Prometheus metrics
 func InitMetrics() *Metrics {
 	m := &Metrics{
-		processedLogs: prometheus.NewCounter(prometheus.CounterOpts{
+		processedLogs: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "syslog_encryptor_processed_logs_total",
 			Help: "Total number of log messages processed by the syslog encryptor",
-		}),
-		processedBytes: prometheus.NewCounter(prometheus.CounterOpts{
+		}, []string{"listener"}),
+		processedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "syslog_encryptor_processed_bytes_total",
 			Help: "Total number of bytes processed by the syslog encryptor",
+		}, []string{"listener"}),
+		routedLogs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_encryptor_routed_logs_total",
+			Help: "Total number of log messages encrypted per recipient route",
+		}, []string{"route"}),
+		connections: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "syslog_encryptor_connections",
+			Help: "Number of currently open stream syslog connections",
+		}, []string{"listener"}),
+		rejectedConns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_encryptor_rejected_connections_total",
+			Help: "Total number of stream connections rejected by connection limits or TLS handshake failures",
+		}, []string{"listener"}),
+		parseFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_encryptor_parse_failures_total",
+			Help: "Total number of messages that could not be parsed as syslog and were passed through unchanged",
+		}, []string{"listener"}),
+		rejectedDgrams: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_encryptor_rejected_datagrams_total",
+			Help: "Total number of Unix datagrams rejected by the peer UID allow-list or as invalid journal entries",
+		}, []string{"listener", "reason"}),
+		queueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "syslog_encryptor_queue_depth",
+			Help: "Number of received messages waiting for encryption and output",
 		}),
+		droppedLogs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_encryptor_dropped_logs_total",
+			Help: "Total number of received messages dropped before encryption",
+		}, []string{"listener", "reason"}),
+		socketQueue: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "syslog_encryptor_socket_receive_queue_bytes",
+			Help: "Bytes waiting in a datagram socket's kernel receive queue",
+		}, []string{"listener"}),
+		socketBuffer: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "syslog_encryptor_socket_receive_buffer_bytes",
+			Help: "Effective kernel receive buffer size of a datagram socket",
+		}, []string{"listener"}),
+		socketDrops: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_encryptor_socket_drops_total",
+			Help: "Total number of datagrams dropped by the kernel before they were read",
+		}, []string{"listener"}),
+		oversizedLogs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_encryptor_oversized_messages_total",
+			Help: "Total number of messages longer than the maximum message size, by the policy applied",
+		}, []string{"listener", "policy"}),
+		multilineLines: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_encryptor_multiline_merged_lines_total",
+			Help: "Total number of lines appended to the previous record by multiline reassembly",
+		}, []string{"listener", "rule"}),
+		tailedFiles: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "syslog_encryptor_tailed_files",
+			Help: "Number of files currently followed by a file listener",
+		}, []string{"listener"}),
+		filteredLogs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_encryptor_filtered_logs_total",
+			Help: "Total number of messages matched by a filter rule, by the action taken",
+		}, []string{"listener", "rule", "action"}),
+		redactions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_encryptor_redactions_total",
+			Help: "Total number of values replaced by redaction before encryption, by pattern",
+		}, []string{"listener", "pattern"}),
+		rateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_encryptor_rate_limited_logs_total",
+			Help: "Total number of messages suppressed by per-sender rate limits",
+		}, []string{"listener"}),
+		rateSenders: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "syslog_encryptor_rate_limited_senders",
+			Help: "Number of senders whose messages were suppressed in the last summary interval",
+		}, []string{"listener"}),
+		outputErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "syslog_encryptor_output_errors_total",
+			Help: "Total number of failed writes and flushes of output sinks",
+		}, []string{"output"}),
 	}
 
 	// Register metrics with Prometheus
 	prometheus.MustRegister(m.processedLogs)
 	prometheus.MustRegister(m.processedBytes)
+	prometheus.MustRegister(m.routedLogs)
+	prometheus.MustRegister(m.connections)
+	prometheus.MustRegister(m.rejectedConns)
+	prometheus.MustRegister(m.parseFailures)
+	prometheus.MustRegister(m.rejectedDgrams)
+	prometheus.MustRegister(m.queueDepth)
+	prometheus.MustRegister(m.droppedLogs)
+	prometheus.MustRegister(m.socketQueue)
+	prometheus.MustRegister(m.socketBuffer)
+	prometheus.MustRegister(m.socketDrops)
+	prometheus.MustRegister(m.oversizedLogs)
+	prometheus.MustRegister(m.multilineLines)
+	prometheus.MustRegister(m.tailedFiles)
+	prometheus.MustRegister(m.filteredLogs)
+	prometheus.MustRegister(m.redactions)
+	prometheus.MustRegister(m.rateLimited)
+	prometheus.MustRegister(m.rateSenders)
+	prometheus.MustRegister(m.outputErrors)
 
 	metrics = m
 	return m
 }
 
-// RecordProcessedLog increments the processed logs counter
-func RecordProcessedLog(messageBytes int) {
+// RecordProcessedLog increments the processed logs counter for a listener
+func RecordProcessedLog(listener string, messageBytes int) {
 	if metrics != nil {
-		metrics.processedLogs.Inc()
-		metrics.processedBytes.Add(float64(messageBytes))
+		metrics.processedLogs.WithLabelValues(listener).Inc()
+		metrics.processedBytes.WithLabelValues(listener).Add(float64(messageBytes))
 	}
 	
 	// Update atomic counters for internal tracking
@@ -56,6 +164,133 @@ func RecordProcessedLog(messageBytes int) {
 	atomic.AddInt64(&totalProcessedBytes, int64(messageBytes))
 }
 
+// RecordRoutedLog increments the per-route counter (empty route is the default)
+func RecordRoutedLog(route string) {
+	if metrics != nil {
+		if route == "" {
+			route = "default"
+		}
+		metrics.routedLogs.WithLabelValues(route).Inc()
+	}
+}
+
+// AddActiveConnections adjusts the open connections gauge for a listener
+func AddActiveConnections(listener string, delta int) {
+	if metrics != nil {
+		metrics.connections.WithLabelValues(listener).Add(float64(delta))
+	}
+}
+
+// RecordRejectedConnection increments the rejected connections counter for a listener
+func RecordRejectedConnection(listener string) {
+	if metrics != nil {
+		metrics.rejectedConns.WithLabelValues(listener).Inc()
+	}
+}
+
+// RecordParseFailure increments the syslog parse failure counter for a listener
+func RecordParseFailure(listener string) {
+	if metrics != nil {
+		metrics.parseFailures.WithLabelValues(listener).Inc()
+	}
+}
+
+// RecordRejectedDatagram increments the rejected datagrams counter for a listener
+func RecordRejectedDatagram(listener, reason string) {
+	if metrics != nil {
+		metrics.rejectedDgrams.WithLabelValues(listener, reason).Inc()
+	}
+}
+
+// SetQueueDepth updates the number of messages waiting in the encryption queue
+func SetQueueDepth(depth int) {
+	if metrics != nil {
+		metrics.queueDepth.Set(float64(depth))
+	}
+}
+
+// RecordDroppedLog increments the dropped messages counter for a listener
+func RecordDroppedLog(listener, reason string) {
+	if metrics != nil {
+		metrics.droppedLogs.WithLabelValues(listener, reason).Inc()
+	}
+}
+
+// SetSocketQueue updates the receive queue usage and buffer size of a datagram socket
+func SetSocketQueue(listener string, queued, buffer int) {
+	if metrics != nil {
+		metrics.socketQueue.WithLabelValues(listener).Set(float64(queued))
+		metrics.socketBuffer.WithLabelValues(listener).Set(float64(buffer))
+	}
+}
+
+// RecordSocketDrops adds datagrams dropped by the kernel for a listener's socket
+func RecordSocketDrops(listener string, drops int) {
+	if metrics != nil {
+		metrics.socketDrops.WithLabelValues(listener).Add(float64(drops))
+	}
+}
+
+// RecordOversizedMessage increments the oversized messages counter for a listener
+func RecordOversizedMessage(listener, policy string) {
+	if metrics != nil {
+		metrics.oversizedLogs.WithLabelValues(listener, policy).Inc()
+	}
+}
+
+// RecordMultilineLine increments the merged lines counter for a listener and rule
+func RecordMultilineLine(listener, rule string) {
+	if metrics != nil {
+		metrics.multilineLines.WithLabelValues(listener, rule).Inc()
+	}
+}
+
+// SetTailedFiles updates the number of files followed by a file listener
+func SetTailedFiles(listener string, files int) {
+	if metrics != nil {
+		metrics.tailedFiles.WithLabelValues(listener).Set(float64(files))
+	}
+}
+
+// RecordFilteredLog increments the counter of messages a filter rule dropped or kept
+func RecordFilteredLog(listener, rule string, dropped bool) {
+	if metrics != nil {
+		action := "keep"
+		if dropped {
+			action = "drop"
+		}
+		metrics.filteredLogs.WithLabelValues(listener, rule, action).Inc()
+	}
+}
+
+// RecordRedactions adds the values a redaction pattern replaced in one message
+func RecordRedactions(listener, pattern string, count int) {
+	if metrics != nil {
+		metrics.redactions.WithLabelValues(listener, pattern).Add(float64(count))
+	}
+}
+
+// RecordRateLimitedLog increments the suppressed messages counter for a listener
+func RecordRateLimitedLog(listener string) {
+	if metrics != nil {
+		metrics.rateLimited.WithLabelValues(listener).Inc()
+	}
+}
+
+// SetRateLimitedSenders updates the number of throttled senders of a listener
+func SetRateLimitedSenders(listener string, senders int) {
+	if metrics != nil {
+		metrics.rateSenders.WithLabelValues(listener).Set(float64(senders))
+	}
+}
+
+// RecordOutputError increments the failed writes counter for an output sink
+func RecordOutputError(output string) {
+	if metrics != nil {
+		metrics.outputErrors.WithLabelValues(output).Inc()
+	}
+}
+
 // GetProcessedLogs returns the current count of processed logs
 func GetProcessedLogs() int64 {
 	return atomic.LoadInt64(&totalProcessedLogs)
@@ -70,4 +305,5 @@ func GetProcessedBytes() int64 {
 func StartMetricsServer(addr string) error {
 	http.Handle("/metrics", promhttp.Handler())
 	return http.ListenAndServe(addr, nil)
-}
\ No newline at end of file
+}
+
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// MultilineConfig describes a reassembly rule from the MULTILINE environment variable.
+// All non-empty match fields must match for the rule to apply.
+type MultilineConfig struct {
+	Name     string `json:"name"`
+	Listener string `json:"listener"` // listener routing tag glob (e.g. "app-*")
+	Tag      string `json:"tag"`      // app-name/tag glob (e.g. "java-*")
+	Mode     string `json:"mode"`     // "continuation", "indent" or "start"
+	Pattern  string `json:"pattern"`  // regex matched against the message body
+	Timeout  string `json:"timeout"`  // flush a record after this long without a new line
+	MaxLines int    `json:"max_lines"`
+}
+
+// Multiline reassembly modes
+const (
+	multilineContinuation = iota // Lines matching the pattern continue the previous record
+	multilineIndent              // Lines starting with a space or tab continue the previous record
+	multilineStart               // Lines matching the pattern start a record, all others continue it
+)
+
+// MultilineRule decides which received lines belong to the same record
+type MultilineRule struct {
+	name     string
+	listener string
+	tag      string
+	mode     int
+	pattern  *regexp.Regexp
+	timeout  time.Duration
+	maxLines int
+}
+
+// ParseMultilineConfigs decodes the JSON array from the MULTILINE environment variable
+func ParseMultilineConfigs(raw string) ([]MultilineConfig, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var configs []MultilineConfig
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		return nil, fmt.Errorf("invalid MULTILINE JSON: %w", err)
+	}
+	return configs, nil
+}
+
+// NewMultilineRules validates reassembly rules
+func NewMultilineRules(configs []MultilineConfig) ([]*MultilineRule, error) {
+	var rules []*MultilineRule
+	for i, cfg := range configs {
+		name := cfg.Name
+		if name == "" {
+			name = fmt.Sprintf("multiline%d", i+1)
+		}
+		rule := &MultilineRule{
+			name:     name,
+			listener: cfg.Listener,
+			tag:      cfg.Tag,
+			timeout:  time.Second,
+			maxLines: 500,
+		}
+
+		for field, glob := range map[string]string{"listener": cfg.Listener, "tag": cfg.Tag} {
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("multiline rule %s: invalid %s pattern: %w", name, field, err)
+			}
+		}
+
+		switch cfg.Mode {
+		case "continuation":
+			rule.mode = multilineContinuation
+		case "indent":
+			rule.mode = multilineIndent
+		case "start":
+			rule.mode = multilineStart
+		default:
+			return nil, fmt.Errorf("multiline rule %s: unknown mode %q (expected continuation, indent or start)", name, cfg.Mode)
+		}
+
+		if cfg.Pattern != "" {
+			pattern, err := regexp.Compile(cfg.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("multiline rule %s: invalid pattern: %w", name, err)
+			}
+			rule.pattern = pattern
+		}
+		if rule.pattern == nil && rule.mode != multilineIndent {
+			return nil, fmt.Errorf("multiline rule %s: %s mode requires a pattern", name, cfg.Mode)
+		}
+
+		if cfg.Timeout != "" {
+			timeout, err := time.ParseDuration(cfg.Timeout)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("multiline rule %s: invalid timeout %q: must be a positive duration (e.g. 500ms, 2s)", name, cfg.Timeout)
+			}
+			rule.timeout = timeout
+		}
+		if cfg.MaxLines < 0 {
+			return nil, fmt.Errorf("multiline rule %s: max_lines must not be negative", name)
+		}
+		if cfg.MaxLines > 0 {
+			rule.maxLines = cfg.MaxLines
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// MultilineRulesFor returns the rules that may apply to a listener's routing tag
+func MultilineRulesFor(rules []*MultilineRule, listenerTag string) []*MultilineRule {
+	var matched []*MultilineRule
+	for _, rule := range rules {
+		if rule.listener != "" {
+			if ok, _ := path.Match(rule.listener, listenerTag); !ok {
+				continue
+			}
+		}
+		matched = append(matched, rule)
+	}
+	return matched
+}
+
+// continues reports whether a line with this body belongs to the record before it
+func (r *MultilineRule) continues(body []byte) bool {
+	switch r.mode {
+	case multilineIndent:
+		return len(body) > 0 && (body[0] == ' ' || body[0] == '\t')
+	case multilineStart:
+		return !r.pattern.Match(body)
+	}
+	return r.pattern.Match(body)
+}
+
+// Multiline reassembles lines that belong together, such as stack traces, into one
+// record before encryption. Lines are grouped per sender; a record is emitted when a
+// line starts a new one, when it reaches its size limits, or after the rule's timeout.
+type Multiline struct {
+	source *Source
+	emit   func(data []byte, meta Metadata, original time.Time)
+	mu     sync.Mutex
+	groups map[string]*multilineGroup
+}
+
+// multilineGroup is a record being reassembled
+type multilineGroup struct {
+	rule     *MultilineRule
+	tag      string // App-name of the first line
+	data     []byte
+	meta     Metadata
+	lines    int
+	timer    *time.Timer
+	original time.Time // Timestamp of the first line, if known outside the message
+}
+
+// NewMultiline creates a reassembler for a source that emits complete records. It returns
+// nil when no multiline rule applies to the source, in which case lines are not held back.
+// The original time passed to emit is that of the record's first line.
+func NewMultiline(source *Source, emit func(data []byte, meta Metadata, original time.Time)) *Multiline {
+	if len(source.Multiline) == 0 {
+		return nil
+	}
+	return &Multiline{
+		source: source,
+		emit:   emit,
+		groups: make(map[string]*multilineGroup),
+	}
+}
+
+// Add processes one received line. Lines held for reassembly are copied; lines no rule
+// applies to are passed to emit unchanged.
+func (m *Multiline) Add(data []byte, meta Metadata) {
+	m.AddAt(data, meta, time.Time{})
+}
+
+// AddAt processes one received line whose original timestamp is known outside the
+// message, e.g. from the container runtime
+func (m *Multiline) AddAt(data []byte, meta Metadata, original time.Time) {
+	// Opaque listeners are parsed on demand, like routing does
+	format := m.source.SyslogFormat
+	if format == SyslogFormatNone {
+		format = SyslogFormatAuto
+	}
+	body, tag := data, ""
+	if parsed, err := ParseSyslog(data, format); err == nil {
+		body, tag = parsed.Message, parsed.AppName
+	}
+	// Lines are grouped per sending process (credentials) or device (UDP); continuation
+	// lines often lack a syslog header, so the header cannot be part of the key
+	key := meta["pid"] + "\x00" + meta["remote_ip"]
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A line with a header from another app-name never continues the record
+	group := m.groups[key]
+	if group != nil && (tag == "" || tag == group.tag) && group.rule.continues(body) && m.fits(group, data) {
+		group.data = append(append(group.data, '\n'), data...)
+		group.lines++
+		RecordMultilineLine(m.source.Name, group.rule.name)
+		group.timer.Reset(group.rule.timeout)
+		return
+	}
+	if group != nil {
+		m.flushLocked(key, group)
+	}
+
+	rule := m.ruleFor(tag)
+	if rule == nil {
+		m.emit(data, meta, original)
+		return
+	}
+	group = &multilineGroup{
+		rule:     rule,
+		tag:      tag,
+		data:     append([]byte(nil), data...),
+		meta:     meta,
+		lines:    1,
+		original: original,
+	}
+	group.timer = time.AfterFunc(rule.timeout, func() { m.flushOnTimer(key, group) })
+	m.groups[key] = group
+}
+
+// ruleFor returns the first rule matching a line's app-name/tag
+func (m *Multiline) ruleFor(tag string) *MultilineRule {
+	for _, rule := range m.source.Multiline {
+		if rule.tag != "" {
+			if ok, _ := path.Match(rule.tag, tag); !ok {
+				continue
+			}
+		}
+		return rule
+	}
+	return nil
+}
+
+// fits reports whether a line can be appended without exceeding the record limits
+func (m *Multiline) fits(group *multilineGroup, data []byte) bool {
+	if group.lines >= group.rule.maxLines {
+		return false
+	}
+	maxSize := m.source.Limit.MaxSize
+	return maxSize <= 0 || len(group.data)+1+len(data) <= maxSize
+}
+
+func (m *Multiline) flushLocked(key string, group *multilineGroup) {
+	group.timer.Stop()
+	delete(m.groups, key)
+	m.emit(group.data, group.meta, group.original)
+}
+
+func (m *Multiline) flushOnTimer(key string, group *multilineGroup) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// The group may already have been emitted by a new line
+	if m.groups[key] == group {
+		m.flushLocked(key, group)
+	}
+}
+
+// Held returns the number of lines held for reassembly
+func (m *Multiline) Held() int {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	held := 0
+	for _, group := range m.groups {
+		held += group.lines
+	}
+	return held
+}
+
+// Flush emits every record still being reassembled, e.g. when a connection closes
+func (m *Multiline) Flush() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, group := range m.groups {
+		m.flushLocked(key, group)
+	}
+}
+
+// logMultilineRules prints the reassembly rules applied to a listener
+func logMultilineRules(listener string, rules []*MultilineRule) {
+	for _, rule := range rules {
+		tag := rule.tag
+		if tag == "" {
+			tag = "*"
+		}
+		log.Printf("Multiline rule %s on %s: tag=%s timeout=%v max_lines=%d", rule.name, listener, tag, rule.timeout, rule.maxLines)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// OutputConfig controls where encrypted records go and how they are batched into writes
+type OutputConfig struct {
+	Default       string        // Output of messages matching no route (see parseOutput)
+	BufferSize    int           // Flush once this many bytes are buffered (0 = write every record)
+	FlushInterval time.Duration // Flush records buffered for this long (0 = only on size and shutdown)
+}
+
+// BufferedOutput batches whole records into large writes to a sink. A record is never
+// split across writes, so several processes can safely append to the same file.
+type BufferedOutput struct {
+	mu       sync.Mutex
+	name     string
+	sink     OutputSink
+	buf      []byte
+	size     int
+	interval time.Duration
+	timer    *time.Timer
+}
+
+// NewBufferedOutput wraps the sink of an output with a record buffer. The buffer is
+// itself an OutputSink, so it can stand in for the sink it wraps.
+func NewBufferedOutput(name string, sink OutputSink, config OutputConfig) *BufferedOutput {
+	return &BufferedOutput{
+		name:     name,
+		sink:     sink,
+		buf:      make([]byte, 0, config.BufferSize),
+		size:     config.BufferSize,
+		interval: config.FlushInterval,
+	}
+}
+
+// Open opens the wrapped sink
+func (o *BufferedOutput) Open() error {
+	return o.sink.Open()
+}
+
+// Write buffers one complete record, flushing first when it does not fit
+func (o *BufferedOutput) Write(record []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.buf)+len(record) > o.size {
+		if err := o.writeLocked(); err != nil {
+			return err
+		}
+		// Records larger than the buffer are written directly
+		if len(record) >= o.size {
+			return o.failed(o.sink.Write(record))
+		}
+	}
+
+	// The first record of a batch starts the flush timer
+	if len(o.buf) == 0 && o.interval > 0 {
+		if o.timer == nil {
+			o.timer = time.AfterFunc(o.interval, o.flushOnTimer)
+		} else {
+			o.timer.Reset(o.interval)
+		}
+	}
+	o.buf = append(o.buf, record...)
+	return nil
+}
+
+// Flush writes all buffered records and flushes the sink
+func (o *BufferedOutput) Flush() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.flushLocked()
+}
+
+// writeLocked hands the buffered records to the sink
+func (o *BufferedOutput) writeLocked() error {
+	if len(o.buf) == 0 {
+		return nil
+	}
+	err := o.sink.Write(o.buf)
+	o.buf = o.buf[:0]
+	return o.failed(err)
+}
+
+func (o *BufferedOutput) flushLocked() error {
+	if err := o.writeLocked(); err != nil {
+		return err
+	}
+	return o.failed(o.sink.Flush())
+}
+
+// failed counts a sink error and names the output in it
+func (o *BufferedOutput) failed(err error) error {
+	if err == nil {
+		return nil
+	}
+	RecordOutputError(o.name)
+	return fmt.Errorf("output %s: %w", o.name, err)
+}
+
+func (o *BufferedOutput) flushOnTimer() {
+	if err := o.Flush(); err != nil {
+		log.Printf("Error flushing output: %v", err)
+	}
+}
+
+// Close flushes buffered records, stops the flush timer and closes the sink
+func (o *BufferedOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+	err := o.flushLocked()
+	if closeErr := o.sink.Close(); err == nil {
+		err = o.failed(closeErr)
+	}
+	return err
+}
+
+// recordBuffers recycles record encoding buffers between messages
+var recordBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, 4096)
+		return &buf
+	},
+}
+
+// appendRecord encrypts a message and appends its JSON line to dst:
+//
+//	{"t":..,"o":..,"z":..,"n":..,"m":..,"r":..,"l":..,"a":{..},"h":..}
+//
+// t is the receive time, o/z the sender's timestamp in UTC and its original offset
+// (the container runtime's time for CRI logs, otherwise the syslog header's),
+// n/m the base64 nonce and ciphertext, r the route, l the listener, a the metadata
+// and h the labels. Optional fields are omitted when empty. a is bound to the
+// ciphertext as additional data; with labels the additional data is {"a":..,"h":..}
+// so neither can be altered. The envelope and metadata are encoded by hand to avoid
+// reflection on the hot path.
+func appendRecord(dst []byte, encryptor *Encryptor, msg *LogMessage, route string, labels *Labels) ([]byte, error) {
+	// The additional data holds the a and h fields, so they are encoded only once
+	buf := recordBuffers.Get().(*[]byte)
+	additionalData := (*buf)[:0]
+	defer func() {
+		*buf = additionalData[:0]
+		recordBuffers.Put(buf)
+	}()
+
+	if labels != nil {
+		additionalData = append(additionalData, '{')
+		if len(msg.Metadata) > 0 {
+			additionalData = append(additionalData, `"a":`...)
+		}
+	}
+	attributesStart := len(additionalData)
+	if len(msg.Metadata) > 0 {
+		additionalData = appendMetadata(additionalData, msg.Metadata)
+	}
+	attributesEnd := len(additionalData)
+	labelsStart := attributesEnd
+	if labels != nil {
+		if len(msg.Metadata) > 0 {
+			additionalData = append(additionalData, ',')
+		}
+		additionalData = append(additionalData, `"h":`...)
+		labelsStart = len(additionalData)
+		var err error
+		if additionalData, err = labels.appendField(additionalData, encryptor); err != nil {
+			return dst, err
+		}
+		additionalData = append(additionalData, '}')
+	}
+	attributes := additionalData[attributesStart:attributesEnd]
+	var labelField []byte
+	if labels != nil {
+		labelField = additionalData[labelsStart : len(additionalData)-1]
+	}
+
+	var nonce [NonceSize]byte
+	scratch := recordBuffers.Get().(*[]byte)
+	defer recordBuffers.Put(scratch)
+	ciphertext, err := encryptor.Seal((*scratch)[:0], nonce[:], msg.Data, additionalData)
+	if err != nil {
+		return dst, fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	*scratch = ciphertext
+
+	dst = append(dst, `{"t":"`...)
+	dst = msg.Received.UTC().AppendFormat(dst, time.RFC3339Nano)
+
+	// Keep the sender's timestamp so timelines survive queueing in socket buffers
+	original := msg.Original
+	if original.IsZero() && msg.Syslog != nil {
+		original = msg.Syslog.Timestamp
+	}
+	if !original.IsZero() {
+		dst = append(dst, `","o":"`...)
+		dst = original.UTC().AppendFormat(dst, time.RFC3339Nano)
+		dst = append(dst, `","z":"`...)
+		dst = original.AppendFormat(dst, "-07:00")
+	}
+
+	dst = append(dst, `","n":"`...)
+	dst = appendBase64(dst, nonce[:])
+	dst = append(dst, `","m":"`...)
+	dst = appendBase64(dst, ciphertext)
+	dst = append(dst, '"')
+
+	if route != "" {
+		dst = append(dst, `,"r":`...)
+		dst = appendJSONString(dst, route)
+	}
+	if msg.Source != nil && msg.Source.Name != "" {
+		dst = append(dst, `,"l":`...)
+		dst = appendJSONString(dst, msg.Source.Name)
+	}
+	if len(attributes) > 0 {
+		dst = append(dst, `,"a":`...)
+		dst = append(dst, attributes...)
+	}
+	if labelField != nil {
+		dst = append(dst, `,"h":`...)
+		dst = append(dst, labelField...)
+	}
+	return append(dst, '}', '\n'), nil
+}
+
+// appendBase64 appends the standard base64 encoding of src to dst
+func appendBase64(dst, src []byte) []byte {
+	n := base64.StdEncoding.EncodedLen(len(src))
+	if cap(dst)-len(dst) < n {
+		grown := make([]byte, len(dst), 2*cap(dst)+n)
+		copy(grown, dst)
+		dst = grown
+	}
+	base64.StdEncoding.Encode(dst[len(dst):len(dst)+n], src)
+	return dst[:len(dst)+n]
+}
+
+// appendMetadata appends the canonical JSON encoding of metadata (sorted keys), encoded
+// exactly as json.Marshal does
+func appendMetadata(dst []byte, m Metadata) []byte {
+	var names [16]string
+	keys := names[:0]
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	dst = append(dst, '{')
+	for i, key := range keys {
+		if i > 0 {
+			dst = append(dst, ',')
+		}
+		dst = appendJSONString(dst, key)
+		dst = append(dst, ':')
+		dst = appendJSONString(dst, m[key])
+	}
+	return append(dst, '}')
+}
+
+// appendJSONString appends s as a quoted JSON string, encoded exactly as json.Marshal
+// does. Names of routes and listeners are plain ASCII in practice, so other strings take
+// the slow path.
+func appendJSONString(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x80 || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			quoted, _ := json.Marshal(s)
+			return append(dst, quoted...)
+		}
+	}
+	dst = append(dst, '"')
+	dst = append(dst, s...)
+	return append(dst, '"')
+}
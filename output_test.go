@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testEncryptor returns an encryptor that encrypts to its own public key
+func testEncryptor(tb testing.TB) *Encryptor {
+	tb.Helper()
+	var privateKey [32]byte
+	privateKey[0] = 1
+	encryptor, err := NewEncryptor(privateKey)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := encryptor.SetupSharedSecret(encryptor.publicKey); err != nil {
+		tb.Fatal(err)
+	}
+	return encryptor
+}
+
+// marshaledRecord is the output envelope as json.Marshal encodes it, which the hand
+// encoding of appendRecord must reproduce
+type marshaledRecord struct {
+	Timestamp     string          `json:"t"`
+	OriginalTime  string          `json:"o,omitempty"`
+	OriginalZone  string          `json:"z,omitempty"`
+	Nonce         string          `json:"n"`
+	EncryptedData string          `json:"m"`
+	Route         string          `json:"r,omitempty"`
+	Listener      string          `json:"l,omitempty"`
+	Attributes    json.RawMessage `json:"a,omitempty"`
+	Labels        json.RawMessage `json:"h,omitempty"`
+}
+
+// openRecord decrypts a record the way the decryptor does: the additional data is
+// rebuilt from the decoded a and h fields with json.Marshal (see decryptor/labels.go)
+func openRecord(encryptor *Encryptor, record []byte) (string, error) {
+	var entry struct {
+		Nonce         string            `json:"n"`
+		EncryptedData string            `json:"m"`
+		Attributes    map[string]string `json:"a"`
+		Labels        json.RawMessage   `json:"h"`
+	}
+	if err := json.Unmarshal(record, &entry); err != nil {
+		return "", err
+	}
+	var additionalData []byte
+	if len(entry.Attributes) > 0 {
+		additionalData, _ = json.Marshal(entry.Attributes)
+	}
+	if len(entry.Labels) > 0 {
+		var labels []byte
+		var encrypted string
+		if err := json.Unmarshal(entry.Labels, &encrypted); err == nil {
+			labels, _ = json.Marshal(encrypted)
+		} else {
+			var values map[string]string
+			if err := json.Unmarshal(entry.Labels, &values); err != nil {
+				return "", err
+			}
+			labels, _ = json.Marshal(values)
+		}
+		data := []byte{'{'}
+		if additionalData != nil {
+			data = append(append(append(data, `"a":`...), additionalData...), ',')
+		}
+		additionalData = append(append(append(data, `"h":`...), labels...), '}')
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(entry.Nonce)
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(entry.EncryptedData)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := encryptor.gcm.Open(nil, nonce, ciphertext, additionalData)
+	return string(plaintext), err
+}
+
+// testMessage is a typical syslog message received on a local socket
+func testMessage() *LogMessage {
+	source := &Source{Name: "unix", SyslogFormat: SyslogFormatAuto}
+	msg := source.NewMessage([]byte("<86>Oct 18 10:00:00 host sshd[4242]: Accepted publickey for deploy from 192.0.2.10 port 52144 ssh2"), Metadata{"pid": "4242", "uid": "0", "gid": "0"})
+	msg.Received = time.Date(2024, 5, 2, 10, 0, 0, 123456789, time.UTC)
+	return msg
+}
+
+func TestAppendRecordMatchesJSONMarshal(t *testing.T) {
+	encryptor := testEncryptor(t)
+	labels, err := NewLabels(LabelConfig{Static: "cluster=prod,zone=<eu & us>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedLabels, err := NewLabels(LabelConfig{Static: "cluster=prod", Encrypt: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone := time.FixedZone("", 2*60*60)
+
+	tests := []struct {
+		name   string
+		msg    func() *LogMessage
+		route  string
+		labels *Labels
+	}{
+		{"syslog message", testMessage, "", nil},
+		{"route and labels", testMessage, "auth", labels},
+		{"encrypted labels", testMessage, "auth", encryptedLabels},
+		{"no metadata or timestamp", func() *LogMessage {
+			msg := testMessage()
+			msg.Metadata = nil
+			msg.Syslog = nil
+			return msg
+		}, "", nil},
+		{"original time", func() *LogMessage {
+			msg := testMessage()
+			msg.Original = time.Date(2024, 5, 2, 12, 0, 0, 500000000, zone)
+			return msg
+		}, "", nil},
+		{"names needing escapes", func() *LogMessage {
+			msg := testMessage()
+			msg.Source = &Source{Name: "tab\there \"quoted\" \\ <html> &   é \xff"}
+			msg.Metadata = Metadata{"file": "/var/log/<a&b>\n.log"}
+			return msg
+		}, "route\x01 ", nil},
+		{"no listener", func() *LogMessage {
+			msg := testMessage()
+			msg.Source = nil
+			return msg
+		}, "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, err := appendRecord(nil, encryptor, tt.msg(), tt.route, tt.labels)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded marshaledRecord
+			if err := json.Unmarshal(record, &decoded); err != nil {
+				t.Fatalf("invalid record %s: %v", record, err)
+			}
+			want, err := json.Marshal(decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, '\n')
+			if !bytes.Equal(record, want) {
+				t.Errorf("record differs from json.Marshal:\n got %s\nwant %s", record, want)
+			}
+			if _, err := openRecord(encryptor, record); err != nil {
+				t.Errorf("record cannot be decrypted as the decryptor rebuilds it: %v", err)
+			}
+		})
+	}
+}
+
+func TestAppendMetadata(t *testing.T) {
+	many := Metadata{}
+	for i := 0; i < 20; i++ {
+		many[fmt.Sprintf("key%02d", 19-i)] = fmt.Sprint(i)
+	}
+	tests := []Metadata{
+		{"pid": "4242", "uid": "0", "gid": "0"},
+		{"remote_ip": "2001:db8::1", "remote_port": "514", "tls_client_cn": "db1.example.com"},
+		{"tls_client_dn": `CN=<a & b>,O="Example",OU=\x`, "file": "/var/log/ünï\tcode\n.log"},
+		{"invalid": "\xff\xfe", "control": "\x00\x1f\u2028"},
+		{"": "empty key"},
+		many,
+	}
+	for _, m := range tests {
+		// The decryptor rebuilds the additional data from the decoded a field with json.Marshal
+		want, err := json.Marshal(map[string]string(m))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := appendMetadata(nil, m); !bytes.Equal(got, want) {
+			t.Errorf("appendMetadata(%q)\n got %s\nwant %s", m, got, want)
+		}
+	}
+}
+
+// benchmarkOutputFile returns a file in a temporary directory for benchmark output
+func benchmarkOutputFile(b *testing.B) *os.File {
+	b.Helper()
+	f, err := os.Create(filepath.Join(b.TempDir(), "out.json"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { f.Close() })
+	return f
+}
+
+// BenchmarkOutputJSONMarshal is the previous output path: the envelope is built with
+// json.Marshal and every record is printed with its own write
+func BenchmarkOutputJSONMarshal(b *testing.B) {
+	encryptor := testEncryptor(b)
+	msg := testMessage()
+	out := benchmarkOutputFile(b)
+	b.SetBytes(int64(len(msg.Data)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		attributes, err := msg.Metadata.Encode()
+		if err != nil {
+			b.Fatal(err)
+		}
+		result, err := encryptor.Encrypt(string(msg.Data), attributes)
+		if err != nil {
+			b.Fatal(err)
+		}
+		entry := marshaledRecord{
+			Timestamp:     msg.Received.UTC().Format(time.RFC3339Nano),
+			OriginalTime:  msg.Syslog.Timestamp.UTC().Format(time.RFC3339Nano),
+			OriginalZone:  msg.Syslog.Timestamp.Format("-07:00"),
+			Nonce:         result.Nonce,
+			EncryptedData: result.EncryptedData,
+			Listener:      msg.Source.Name,
+			Attributes:    attributes,
+		}
+		jsonData, err := json.Marshal(entry)
+		if err != nil {
+			b.Fatal(err)
+		}
+		fmt.Fprintln(out, string(jsonData))
+	}
+}
+
+// BenchmarkOutputAppendRecord is the current output path: records are encoded by hand
+// into pooled buffers and batched by a BufferedOutput
+func BenchmarkOutputAppendRecord(b *testing.B) {
+	for _, size := range []int{0, 65536} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			encryptor := testEncryptor(b)
+			msg := testMessage()
+			out := NewBufferedOutput("file", &fileSink{file: benchmarkOutputFile(b)}, OutputConfig{BufferSize: size})
+			b.SetBytes(int64(len(msg.Data)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				buf := recordBuffers.Get().(*[]byte)
+				record, err := appendRecord((*buf)[:0], encryptor, msg, "", nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if err := out.Write(record); err != nil {
+					b.Fatal(err)
+				}
+				*buf = record
+				recordBuffers.Put(buf)
+			}
+			if err := out.Flush(); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
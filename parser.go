@@ -2,14 +2,180 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"os"
+	"strconv"
 )
 
+// Framing selects how messages are separated in a byte stream
+type Framing int
+
+const (
+	// FramingDelimiter splits messages on a delimiter byte (RFC 6587 non-transparent framing)
+	FramingDelimiter Framing = iota
+	// FramingOctetCounted reads "MSG-LEN SP MSG" frames (RFC 6587 octet-counting)
+	FramingOctetCounted
+	// FramingAuto detects octet-counting per frame by a leading digit, otherwise uses the delimiter
+	FramingAuto
+	// FramingWhole treats the entire input as a single message
+	FramingWhole
+	// FramingJournal reads systemd journal export format entries (journalctl -o export)
+	FramingJournal
+)
+
+// ErrFrameTooLarge is returned when an octet-counted frame or journal entry exceeds the parser's frame limit
+var ErrFrameTooLarge = errors.New("octet-counted frame exceeds maximum size")
+
+// ParseFraming converts a framing name ("delimiter", "octet", "auto", "whole", "journal") to a Framing
+func ParseFraming(name string) (Framing, error) {
+	switch name {
+	case "", "delimiter", "lf":
+		return FramingDelimiter, nil
+	case "octet", "octet-counted":
+		return FramingOctetCounted, nil
+	case "auto":
+		return FramingAuto, nil
+	case "whole":
+		return FramingWhole, nil
+	case "journal", "export":
+		return FramingJournal, nil
+	}
+	return 0, fmt.Errorf("unknown framing %q (expected delimiter, octet, auto, whole or journal)", name)
+}
+
+// ParseDelimiter converts a delimiter name ("lf", "crlf", "nul") to its byte value.
+// CRLF messages are split on LF; callers strip the trailing CR.
+func ParseDelimiter(name string) (byte, error) {
+	switch name {
+	case "", "lf", "crlf":
+		return '\n', nil
+	case "nul":
+		return 0, nil
+	}
+	return 0, fmt.Errorf("unknown delimiter %q (expected lf, crlf or nul)", name)
+}
+
+// SizePolicy selects what happens to messages longer than the maximum message size
+type SizePolicy int
+
+const (
+	// SizePolicyTruncate keeps the start of the message and ends it with a marker
+	SizePolicyTruncate SizePolicy = iota
+	// SizePolicySplit emits the message as several consecutive messages
+	SizePolicySplit
+	// SizePolicyDrop discards the message
+	SizePolicyDrop
+)
+
+// truncationMarker ends truncated messages so readers know content is missing
+const truncationMarker = "...[truncated]"
+
+// minMessageSize is the smallest message size limit, leaving room for the marker
+const minMessageSize = 64
+
+// ParseSizePolicy converts a policy name ("truncate", "split", "drop") to a SizePolicy
+func ParseSizePolicy(name string) (SizePolicy, error) {
+	switch name {
+	case "", "truncate":
+		return SizePolicyTruncate, nil
+	case "split":
+		return SizePolicySplit, nil
+	case "drop":
+		return SizePolicyDrop, nil
+	}
+	return 0, fmt.Errorf("unknown oversize policy %q (expected truncate, split or drop)", name)
+}
+
+// String returns the policy name used in configuration and metrics
+func (p SizePolicy) String() string {
+	switch p {
+	case SizePolicySplit:
+		return "split"
+	case SizePolicyDrop:
+		return "drop"
+	}
+	return "truncate"
+}
+
+// MessageLimit bounds the size of a single message
+type MessageLimit struct {
+	MaxSize int        // Maximum message size in bytes (0 = unlimited)
+	Policy  SizePolicy // What to do with longer messages
+}
+
+// NewMessageLimit validates a message size limit. A nil size falls back to
+// MAX_MESSAGE_SIZE and an empty policy to OVERSIZE_POLICY.
+func NewMessageLimit(size *int, policyName string) (MessageLimit, error) {
+	maxSize := getEnvInt("MAX_MESSAGE_SIZE", 65536)
+	if size != nil {
+		maxSize = *size
+	}
+	if maxSize != 0 && maxSize < minMessageSize {
+		return MessageLimit{}, fmt.Errorf("invalid max_message_size %d: must be 0 (unlimited) or at least %d", maxSize, minMessageSize)
+	}
+
+	if policyName == "" {
+		policyName = os.Getenv("OVERSIZE_POLICY")
+	}
+	policy, err := ParseSizePolicy(policyName)
+	if err != nil {
+		return MessageLimit{}, err
+	}
+	return MessageLimit{MaxSize: maxSize, Policy: policy}, nil
+}
+
+// Apply enforces the limit on a complete message such as a datagram, returning the
+// messages to process in its place. Split parts share data's backing array.
+func (l MessageLimit) Apply(listener string, data []byte) [][]byte {
+	if l.MaxSize <= 0 || len(data) <= l.MaxSize {
+		return [][]byte{data}
+	}
+	l.record(listener)
+
+	switch l.Policy {
+	case SizePolicySplit:
+		var parts [][]byte
+		for len(data) > l.MaxSize {
+			parts = append(parts, data[:l.MaxSize])
+			data = data[l.MaxSize:]
+		}
+		return append(parts, data)
+	case SizePolicyDrop:
+		return nil
+	}
+	return [][]byte{l.truncate(data)}
+}
+
+// truncate returns a copy of the start of data ending with the truncation marker,
+// MaxSize bytes long in total
+func (l MessageLimit) truncate(data []byte) []byte {
+	message := make([]byte, 0, l.MaxSize)
+	message = append(message, data[:l.MaxSize-len(truncationMarker)]...)
+	return append(message, truncationMarker...)
+}
+
+// record counts an oversized message
+func (l MessageLimit) record(listener string) {
+	RecordOversizedMessage(listener, l.Policy.String())
+	if l.Policy == SizePolicyDrop {
+		RecordDroppedLog(listener, "too_large")
+	}
+}
+
 // MessageParser handles delimiter-based message parsing from any reader
 type MessageParser struct {
-	delimiter byte
-	buffer    []byte
-	reader    io.Reader
+	delimiter    byte
+	framing      Framing
+	maxFrameSize int
+	limit        MessageLimit
+	listener     string   // Listener name for oversized message metrics
+	pending      [][]byte // Split parts of an oversized octet-counted frame
+	discarding   bool     // Skipping the rest of a truncated or dropped message
+	splitting    bool     // Emitting the remaining parts of a split message
+	buffer       []byte
+	reader       io.Reader
 }
 
 // NewMessageParser creates a new parser with specified delimiter
@@ -21,24 +187,175 @@ func NewMessageParser(reader io.Reader, delimiter byte) *MessageParser {
 	}
 }
 
-// ReadMessage reads bytes until delimiter, returns message without delimiter
+// NewFramedMessageParser creates a parser for syslog streams using the given framing.
+// maxFrameSize bounds the declared length of octet-counted frames.
+func NewFramedMessageParser(reader io.Reader, framing Framing, delimiter byte, maxFrameSize int) *MessageParser {
+	p := NewMessageParser(reader, delimiter)
+	p.framing = framing
+	p.maxFrameSize = maxFrameSize
+	return p
+}
+
+// SetLimit bounds the size of returned messages. Delimited messages are cut while
+// reading, so a sender that never sends a delimiter cannot grow the buffer past the limit.
+func (p *MessageParser) SetLimit(listener string, limit MessageLimit) {
+	p.listener = listener
+	p.limit = limit
+}
+
+// Buffered returns the number of bytes read from the reader but not yet returned
+func (p *MessageParser) Buffered() int {
+	return len(p.buffer)
+}
+
+// AtBoundary reports whether the bytes consumed so far end between messages, so reading
+// can resume after them: no parts of a split message remain and no dropped message is
+// being skipped
+func (p *MessageParser) AtBoundary() bool {
+	return len(p.pending) == 0 && !p.splitting && !p.discarding
+}
+
+// ReadMessage reads the next message according to the parser's framing
 func (p *MessageParser) ReadMessage() ([]byte, error) {
+	for len(p.pending) == 0 {
+		if p.framing == FramingJournal {
+			// Entries are bounded by maxFrameSize like octet-counted frames
+			entry, err := p.readJournalEntry()
+			if err != nil {
+				return nil, err
+			}
+			p.pending = p.limit.Apply(p.listener, entry)
+			continue
+		}
+
+		octetCounted, err := p.nextIsOctetCounted()
+		if err != nil {
+			return nil, err
+		}
+
+		if !octetCounted {
+			message, err := p.readDelimited()
+			if err != nil || message != nil {
+				return message, err
+			}
+			continue // Oversized message dropped
+		}
+
+		// Frames are already bounded by maxFrameSize, so the limit is applied afterwards
+		frame, err := p.readOctetCounted()
+		if err != nil {
+			return nil, err
+		}
+		p.pending = p.limit.Apply(p.listener, frame)
+	}
+
+	message := p.pending[0]
+	p.pending = p.pending[1:]
+	return message, nil
+}
+
+// nextIsOctetCounted reports whether the next message uses octet-counted framing
+func (p *MessageParser) nextIsOctetCounted() (bool, error) {
+	// The rest of a cut message is always delimited
+	if p.discarding || p.splitting {
+		return false, nil
+	}
+
+	switch p.framing {
+	case FramingOctetCounted:
+		return true, nil
+	case FramingAuto:
+		if err := p.fill(1); err != nil {
+			return false, err
+		}
+		return p.buffer[0] >= '1' && p.buffer[0] <= '9', nil
+	}
+	return false, nil
+}
+
+// readOctetCounted reads a single "MSG-LEN SP MSG" frame
+func (p *MessageParser) readOctetCounted() ([]byte, error) {
+	// MSG-LEN is at most 10 digits followed by a space
+	for {
+		if i := bytes.IndexByte(p.buffer, ' '); i >= 0 {
+			length, err := strconv.Atoi(string(p.buffer[:i]))
+			if err != nil || length <= 0 {
+				return nil, fmt.Errorf("invalid octet count %q", p.buffer[:i])
+			}
+			if p.maxFrameSize > 0 && length > p.maxFrameSize {
+				return nil, ErrFrameTooLarge
+			}
+			if err := p.fill(i + 1 + length); err != nil {
+				if err == io.EOF {
+					return nil, io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+			message := make([]byte, length)
+			copy(message, p.buffer[i+1:i+1+length])
+			p.buffer = append(p.buffer[:0], p.buffer[i+1+length:]...)
+			return message, nil
+		}
+		if len(p.buffer) > 10 {
+			return nil, fmt.Errorf("invalid octet count header")
+		}
+		if err := p.fill(len(p.buffer) + 1); err != nil {
+			if err == io.EOF && len(p.buffer) > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+}
+
+// fill reads until the buffer holds at least n bytes
+func (p *MessageParser) fill(n int) error {
+	readBuffer := make([]byte, 4096)
+	for len(p.buffer) < n {
+		read, err := p.reader.Read(readBuffer)
+		p.buffer = append(p.buffer, readBuffer[:read]...)
+		if err != nil {
+			if len(p.buffer) >= n {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// readDelimited reads bytes until delimiter, returns message without delimiter.
+// With FramingWhole the message ends at EOF. A nil message means an oversized
+// message was dropped.
+func (p *MessageParser) readDelimited() ([]byte, error) {
 	readBuffer := make([]byte, 4096)
 	
 	for {
-		// First check if we have complete messages in buffer
-		for {
-			delimIndex := bytes.IndexByte(p.buffer, p.delimiter)
+		delimIndex := -1
+		if p.framing != FramingWhole {
+			delimIndex = bytes.IndexByte(p.buffer, p.delimiter)
+		}
+		maxSize := p.limit.MaxSize
+
+		if p.discarding {
+			// Skip the rest of an oversized message up to its delimiter
 			if delimIndex == -1 {
-				break // No complete message yet
+				p.buffer = p.buffer[:0]
+			} else {
+				p.buffer = append(p.buffer[:0], p.buffer[delimIndex+1:]...)
+				p.discarding = false
+				return nil, nil
 			}
-			
+		} else if maxSize > 0 && (delimIndex > maxSize || delimIndex == -1 && len(p.buffer) > maxSize) {
+			return p.cutOversized(delimIndex), nil
+		} else if delimIndex >= 0 {
 			// Extract message (excluding delimiter)
 			message := make([]byte, delimIndex)
 			copy(message, p.buffer[:delimIndex])
 			
 			// Remove processed data from buffer (including delimiter)
 			p.buffer = append(p.buffer[:0], p.buffer[delimIndex+1:]...)
+			p.splitting = false
 			
 			return message, nil
 		}
@@ -46,6 +363,11 @@ func (p *MessageParser) ReadMessage() ([]byte, error) {
 		// Read more data
 		n, err := p.reader.Read(readBuffer)
 		if err != nil {
+			if err == io.EOF {
+				// EOF ends the message being cut as well
+				p.splitting = false
+				p.discarding = false
+			}
 			if err == io.EOF && len(p.buffer) > 0 {
 				// Return remaining buffer on EOF
 				msg := make([]byte, len(p.buffer))
@@ -56,12 +378,43 @@ func (p *MessageParser) ReadMessage() ([]byte, error) {
 			return nil, err
 		}
 		
-		// Note: Unbounded buffer growth is acceptable since stdin is only used for testing
-		// in controlled environments, not production deployment
+		// The buffer holds at most one read beyond the message size limit
 		p.buffer = append(p.buffer, readBuffer[:n]...)
 	}
 }
 
+// cutOversized applies the size policy to a message at the start of the buffer that is
+// longer than the limit. delimIndex is where the message ends, or -1 if not yet read.
+func (p *MessageParser) cutOversized(delimIndex int) []byte {
+	maxSize := p.limit.MaxSize
+
+	// Count each message once, not every part of a split message
+	if !p.splitting {
+		p.limit.record(p.listener)
+	}
+
+	if p.limit.Policy == SizePolicySplit {
+		// The remainder stays buffered and is returned as the following message(s)
+		message := make([]byte, maxSize)
+		copy(message, p.buffer[:maxSize])
+		p.buffer = append(p.buffer[:0], p.buffer[maxSize:]...)
+		p.splitting = true
+		return message
+	}
+
+	var message []byte
+	if p.limit.Policy == SizePolicyTruncate {
+		message = p.limit.truncate(p.buffer)
+	}
+	if delimIndex >= 0 {
+		p.buffer = append(p.buffer[:0], p.buffer[delimIndex+1:]...)
+	} else {
+		p.buffer = p.buffer[:0]
+		p.discarding = true
+	}
+	return message
+}
+
 // StripTrailingNewline removes trailing newline characters from syslog messages
 // This provides consistent handling for both stdin and datagram sources
 func StripTrailingNewline(data []byte) []byte {
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// chunkReader returns one chunk per Read, so messages arrive split across reads
+type chunkReader struct {
+	chunks []string
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	if n < len(r.chunks[0]) {
+		r.chunks[0] = r.chunks[0][n:]
+	} else {
+		r.chunks = r.chunks[1:]
+	}
+	return n, nil
+}
+
+// readAll returns the messages of a parser up to EOF and whether it ended at a boundary
+func readAll(t *testing.T, parser *MessageParser) ([]string, bool) {
+	t.Helper()
+	var messages []string
+	for {
+		message, err := parser.ReadMessage()
+		if err == io.EOF {
+			return messages, parser.AtBoundary()
+		}
+		if err != nil {
+			t.Fatalf("ReadMessage: %v (after %q)", err, messages)
+		}
+		messages = append(messages, string(message))
+	}
+}
+
+func TestReadMessageSizeLimit(t *testing.T) {
+	a, b, c := strings.Repeat("a", 25), strings.Repeat("b", 10), strings.Repeat("c", 45)
+	truncated := func(s string) string { return s[:20-len(truncationMarker)] + truncationMarker }
+
+	tests := []struct {
+		name    string
+		framing Framing
+		policy  SizePolicy
+		max     int
+		chunks  []string
+		want    []string
+	}{
+		{"unlimited", FramingDelimiter, SizePolicyTruncate, 0, []string{c + "\n"}, []string{c}},
+		{"exactly the limit", FramingDelimiter, SizePolicyTruncate, 20, []string{a[:20] + "\nnext\n"}, []string{a[:20], "next"}},
+		{"empty lines are kept", FramingDelimiter, SizePolicyTruncate, 20, []string{"\n\nnext\n"}, []string{"", "", "next"}},
+
+		// truncate: in one read, and discarding the rest across reads
+		{"truncate", FramingDelimiter, SizePolicyTruncate, 20, []string{a + "\nnext\n"}, []string{truncated(a), "next"}},
+		{"truncate across reads", FramingDelimiter, SizePolicyTruncate, 20, []string{a, b, "c\nnext\n"}, []string{truncated(a), "next"}},
+		{"truncate delimiter in next read", FramingDelimiter, SizePolicyTruncate, 20, []string{a, "\n", "next\n"}, []string{truncated(a), "next"}},
+
+		// drop
+		{"drop", FramingDelimiter, SizePolicyDrop, 20, []string{"before\n" + a + "\nnext\n"}, []string{"before", "next"}},
+		{"drop across reads", FramingDelimiter, SizePolicyDrop, 20, []string{a, b, "\nnext\n"}, []string{"next"}},
+
+		// split: parts are emitted as they fill, the remainder when the delimiter arrives
+		{"split", FramingDelimiter, SizePolicySplit, 20, []string{c + "\nnext\n"}, []string{c[:20], c[20:40], c[40:], "next"}},
+		{"split across reads", FramingDelimiter, SizePolicySplit, 20, []string{a[:21], b + b + b + "\n", "next\n"}, []string{a[:20], "a" + strings.Repeat("b", 19), strings.Repeat("b", 11), "next"}},
+		{"split at the limit", FramingDelimiter, SizePolicySplit, 20, []string{c[:40], "\nnext\n"}, []string{c[:20], c[20:40], "next"}},
+
+		// EOF ends a message without delimiter, or the skipped rest of one
+		{"EOF without delimiter", FramingDelimiter, SizePolicyTruncate, 20, []string{"one\ntwo"}, []string{"one", "two"}},
+		{"EOF while discarding", FramingDelimiter, SizePolicyTruncate, 20, []string{"one\n", a, b}, []string{"one", truncated(a)}},
+		{"EOF while dropping", FramingDelimiter, SizePolicyDrop, 20, []string{"one\n", a, b}, []string{"one"}},
+		{"EOF while splitting", FramingDelimiter, SizePolicySplit, 20, []string{a}, []string{a[:20], a[20:]}},
+
+		// whole input as one message
+		{"whole", FramingWhole, SizePolicyTruncate, 20, []string{"one\n", "two"}, []string{"one\ntwo"}},
+		{"whole truncated", FramingWhole, SizePolicyTruncate, 20, []string{a, b}, []string{truncated(a)}},
+
+		// octet-counted frames are cut after reading
+		{"octet-counted split", FramingOctetCounted, SizePolicySplit, 20, []string{"25 " + a + "4 next"}, []string{a[:20], a[20:], "next"}},
+		{"octet-counted truncate", FramingAuto, SizePolicyTruncate, 20, []string{"25 " + a, "plain\n"}, []string{truncated(a), "plain"}},
+		{"octet-counted drop", FramingOctetCounted, SizePolicyDrop, 20, []string{"25 " + a + "4 next"}, []string{"next"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := NewFramedMessageParser(&chunkReader{chunks: tt.chunks}, tt.framing, '\n', 0)
+			parser.SetLimit("test", MessageLimit{MaxSize: tt.max, Policy: tt.policy})
+			got, boundary := readAll(t, parser)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("messages\n got %q\nwant %q", got, tt.want)
+			}
+			if !boundary {
+				t.Error("parser not at a message boundary after EOF")
+			}
+		})
+	}
+}
+
+func TestReadMessageBoundary(t *testing.T) {
+	a := strings.Repeat("a", 45)
+	tests := []struct {
+		name     string
+		policy   SizePolicy
+		chunks   []string
+		boundary []bool // AtBoundary after each message
+	}{
+		{"split parts", SizePolicySplit, []string{a + "\nnext\n"}, []bool{false, false, true, true}},
+		{"split across reads", SizePolicySplit, []string{a[:30], a[30:] + "\n"}, []bool{false, false, true}},
+		{"truncated rest not yet read", SizePolicyTruncate, []string{a[:30], a[30:] + "\nnext\n"}, []bool{false, true}},
+		{"truncated in one read", SizePolicyTruncate, []string{a + "\nnext\n"}, []bool{true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser := NewMessageParser(&chunkReader{chunks: tt.chunks}, '\n')
+			parser.SetLimit("test", MessageLimit{MaxSize: 20, Policy: tt.policy})
+			var got []bool
+			for {
+				if _, err := parser.ReadMessage(); err != nil {
+					break
+				}
+				got = append(got, parser.AtBoundary())
+			}
+			if !reflect.DeepEqual(got, tt.boundary) {
+				t.Errorf("AtBoundary after each message = %v, want %v", got, tt.boundary)
+			}
+		})
+	}
+}
+
+func TestMessageLimitApply(t *testing.T) {
+	data := []byte(strings.Repeat("x", 50))
+	tests := []struct {
+		limit MessageLimit
+		want  []int // Lengths of the resulting messages
+	}{
+		{MessageLimit{MaxSize: 0}, []int{50}},
+		{MessageLimit{MaxSize: 50, Policy: SizePolicyDrop}, []int{50}},
+		{MessageLimit{MaxSize: 20, Policy: SizePolicyTruncate}, []int{20}},
+		{MessageLimit{MaxSize: 20, Policy: SizePolicySplit}, []int{20, 20, 10}},
+		{MessageLimit{MaxSize: 25, Policy: SizePolicySplit}, []int{25, 25}},
+		{MessageLimit{MaxSize: 20, Policy: SizePolicyDrop}, nil},
+	}
+	for _, tt := range tests {
+		var got []int
+		for _, message := range tt.limit.Apply("test", data) {
+			got = append(got, len(message))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Apply with %+v = lengths %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestReadMessageWholeStdin(t *testing.T) {
+	input := strings.Repeat("0123456789abcdef\n", 6000) // ~100 KB, over the default limit
+	chunks := []string{input[:40000], input[40000:80000], input[80000:]}
+
+	tests := []struct {
+		name    string
+		maxSize string // MAX_MESSAGE_SIZE, "unset" to leave it out
+		want    int    // Length of the single record
+	}{
+		{"unlimited by default", "unset", len(input)},
+		{"explicit limit", "65536", 65536},
+		{"explicit unlimited", "0", len(input)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_MESSAGE_SIZE", tt.maxSize)
+			if tt.maxSize == "unset" {
+				os.Unsetenv("MAX_MESSAGE_SIZE")
+			}
+			limit, err := stdinMessageLimit(StdinConfig{Framing: FramingWhole})
+			if err != nil {
+				t.Fatal(err)
+			}
+			parser := NewFramedMessageParser(&chunkReader{chunks: append([]string(nil), chunks...)}, FramingWhole, '\n', 65536)
+			parser.SetLimit("stdin", limit)
+			got, _ := readAll(t, parser)
+			if len(got) != 1 || len(got[0]) != tt.want {
+				t.Fatalf("got %d records, want one of %d bytes", len(got), tt.want)
+			}
+			if tt.want == len(input) && got[0] != input {
+				t.Error("record differs from the input")
+			}
+		})
+	}
+
+	// Other framings keep the default limit
+	t.Setenv("MAX_MESSAGE_SIZE", "")
+	os.Unsetenv("MAX_MESSAGE_SIZE")
+	if limit, err := stdinMessageLimit(StdinConfig{Framing: FramingDelimiter}); err != nil || limit.MaxSize != 65536 {
+		t.Errorf("delimited stdin limit = %+v, %v, want 65536", limit, err)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Pipeline decouples socket reads from encryption and output. Listeners enqueue
+// received messages on a bounded queue, workers parse, route and encrypt them in
+// parallel, and a single writer outputs the records in the order they were received.
+type Pipeline struct {
+	router  *Router
+	jobs    chan *pipelineJob // Messages waiting for a worker
+	ordered chan *pipelineJob // The same messages in receive order, for the writer
+	mu      sync.RWMutex      // Guards closed against enqueues during shutdown
+	closed  bool
+	workers sync.WaitGroup
+	done    chan struct{} // Closed once the writer has output every queued record
+}
+
+// pipelineJob is a received message on its way through the pipeline
+type pipelineJob struct {
+	source   *Source
+	data     []byte
+	meta     Metadata
+	original time.Time // Sender's timestamp known outside the message (optional)
+	received time.Time
+	buf      *[]byte // Pooled buffer holding record, returned after output
+	record   []byte
+	output   OutputSink
+	err      error
+	ready    chan struct{} // Closed by the worker when record or err is set
+	done     func()        // Called by the writer once the record was output (optional)
+}
+
+// NewPipeline starts the encryption workers and the output writer. With zero workers
+// messages are encrypted and written synchronously on the listener's goroutine.
+func NewPipeline(router *Router, workers, queueSize int) *Pipeline {
+	p := &Pipeline{router: router}
+	if workers <= 0 {
+		return p
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	// A job leaves ordered before its worker finishes, so at most queueSize+1
+	// jobs are in flight and sends to jobs never block
+	p.ordered = make(chan *pipelineJob, queueSize)
+	p.jobs = make(chan *pipelineJob, queueSize+1)
+	p.done = make(chan struct{})
+
+	for i := 0; i < workers; i++ {
+		p.workers.Add(1)
+		go p.work()
+	}
+	go p.write()
+
+	log.Printf("Encryption pipeline: %d workers, queue size %d", workers, queueSize)
+	return p
+}
+
+// Process queues a message, waiting for space when the queue is full so stream
+// senders are slowed down instead of losing messages. data must not be reused.
+// Messages over the source's rate limit are suppressed.
+func (p *Pipeline) Process(source *Source, data []byte, meta Metadata) error {
+	return p.ProcessThen(source, data, meta, time.Time{}, nil)
+}
+
+// ProcessThen queues a message like Process, with its original timestamp if known
+// outside the message, and calls done (if set) once its record was handed to its
+// output, after the records of all messages queued before it. A suppressed or filtered
+// message is done in the same order.
+func (p *Pipeline) ProcessThen(source *Source, data []byte, meta Metadata, original time.Time, done func()) error {
+	if !source.RateLimit.Allow(data, meta) {
+		if done == nil {
+			return nil
+		}
+		return p.Mark(done)
+	}
+	return p.process(source, data, meta, original, done)
+}
+
+// process queues a message without applying the rate limit
+func (p *Pipeline) process(source *Source, data []byte, meta Metadata, original time.Time, done func()) error {
+	if p.ordered == nil {
+		msg := source.NewMessage(data, meta)
+		msg.Original = original
+		err := p.router.Process(msg)
+		if done != nil {
+			done()
+		}
+		return err
+	}
+	return p.enqueue(&pipelineJob{source: source, data: data, meta: meta, original: original, done: done}, true)
+}
+
+// Mark calls done once the records of all messages queued before were handed to
+// their outputs
+func (p *Pipeline) Mark(done func()) error {
+	if p.ordered == nil {
+		done()
+		return nil
+	}
+	return p.enqueue(&pipelineJob{done: done}, true)
+}
+
+// Drain waits until the records of all messages queued so far were handed to their outputs
+func (p *Pipeline) Drain() {
+	drained := make(chan struct{})
+	if err := p.Mark(func() { close(drained) }); err != nil {
+		return // Closed pipelines are drained by Close
+	}
+	<-drained
+}
+
+// Flush writes the records buffered by the outputs
+func (p *Pipeline) Flush() error {
+	return p.router.Flush()
+}
+
+// Offer queues a copy of a datagram, dropping it when the queue is full so the
+// reader can keep draining the socket. Returns false when the message was dropped.
+func (p *Pipeline) Offer(source *Source, data []byte, meta Metadata) bool {
+	if !source.RateLimit.Allow(data, meta) {
+		return false
+	}
+	if p.ordered == nil {
+		if err := p.router.Process(source.NewMessage(data, meta)); err != nil {
+			log.Printf("Error processing %s message: %v", source.Name, err)
+		}
+		return true
+	}
+	return p.enqueue(&pipelineJob{source: source, data: append([]byte(nil), data...), meta: meta}, false) == nil
+}
+
+// NewRateLimiter starts the rate limiter of a source. Its summary records are queued
+// like received messages, from a "<listener>/rate_limit" source with the listener's tag.
+func (p *Pipeline) NewRateLimiter(source *Source, config RateLimitConfig) *RateLimiter {
+	summaries := &Source{
+		Name:           source.Name + "/rate_limit",
+		Tag:            source.Tag,
+		SyslogFormat:   SyslogFormatAuto,
+		MetadataFields: source.MetadataFields,
+	}
+	return NewRateLimiter(source, config, func(data []byte, meta Metadata) {
+		if err := p.process(summaries, data, meta, time.Time{}, nil); err != nil {
+			log.Printf("Error processing %s rate limit summary: %v", source.Name, err)
+		}
+	})
+}
+
+// enqueue queues a job; a job without a source only marks a position in the output order
+func (p *Pipeline) enqueue(job *pipelineJob, wait bool) error {
+	job.received = time.Now()
+	job.ready = make(chan struct{})
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return fmt.Errorf("pipeline closed")
+	}
+
+	if wait {
+		p.ordered <- job
+	} else {
+		select {
+		case p.ordered <- job:
+		default:
+			RecordDroppedLog(job.source.Name, "queue_full")
+			return fmt.Errorf("queue full")
+		}
+	}
+	p.jobs <- job
+	SetQueueDepth(len(p.ordered))
+	return nil
+}
+
+// work parses, routes and encrypts queued messages
+func (p *Pipeline) work() {
+	defer p.workers.Done()
+	for job := range p.jobs {
+		if job.source == nil {
+			close(job.ready)
+			continue
+		}
+		msg := job.source.NewMessage(job.data, job.meta)
+		msg.Original = job.original
+		msg.Received = job.received
+		job.buf = recordBuffers.Get().(*[]byte)
+		job.record, job.output, job.err = p.router.AppendRecord((*job.buf)[:0], msg)
+		close(job.ready)
+	}
+}
+
+// write outputs records in receive order as their workers finish
+func (p *Pipeline) write() {
+	defer close(p.done)
+	for job := range p.ordered {
+		SetQueueDepth(len(p.ordered))
+		<-job.ready
+		switch {
+		case job.source == nil:
+			// Position mark
+		case job.err != nil:
+			log.Printf("Error processing %s message: %v", job.source.Name, job.err)
+		case job.output == nil:
+			// Dropped by a filter rule
+		default:
+			if err := job.output.Write(job.record); err != nil {
+				log.Printf("Error writing %s record: %v", job.source.Name, err)
+			}
+		}
+		if job.buf != nil {
+			*job.buf = job.record[:0]
+			recordBuffers.Put(job.buf)
+		}
+		if job.done != nil {
+			job.done()
+		}
+	}
+}
+
+// Close stops accepting messages and waits until every queued record is written
+func (p *Pipeline) Close() {
+	if p.ordered == nil {
+		return
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.ordered)
+	close(p.jobs)
+	p.mu.Unlock()
+
+	p.workers.Wait()
+	<-p.done
+}
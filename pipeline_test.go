@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testRouter writes records to a file without buffering
+func testRouter(t *testing.T) (*Router, string) {
+	t.Helper()
+	encryptor := testEncryptor(t)
+	path := filepath.Join(t.TempDir(), "out.json")
+	router, err := NewRouter(encryptor.privateKey, encryptor, nil, nil, nil, nil, OutputConfig{Default: "file:" + path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(router.Close)
+	return router, path
+}
+
+func TestPipelineDoneAfterOutput(t *testing.T) {
+	for _, workers := range []int{0, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			router, path := testRouter(t)
+			pipeline := NewPipeline(router, workers, 8)
+			source := &Source{Name: "test"}
+
+			// done runs on the writer, in queue order, once every earlier record is in the file
+			var order []int
+			done := func(i, records int) func() {
+				return func() {
+					order = append(order, i)
+					data, err := os.ReadFile(path)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if got := bytes.Count(data, []byte{'\n'}); got != records {
+						t.Errorf("done %d: %d records written, want %d", i, got, records)
+					}
+				}
+			}
+			records := 0
+			for i := 0; i < 20; i++ {
+				if i%5 == 4 {
+					if err := pipeline.Mark(done(i, records)); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				records++
+				if err := pipeline.ProcessThen(source, []byte(fmt.Sprintf("message %d", i)), nil, time.Time{}, done(i, records)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			pipeline.Drain()
+
+			if len(order) != 20 {
+				t.Fatalf("%d callbacks, want 20", len(order))
+			}
+			for i, got := range order {
+				if got != i {
+					t.Fatalf("callbacks ran in order %v", order)
+				}
+			}
+			pipeline.Close()
+		})
+	}
+}
+
+func TestMultilineHeld(t *testing.T) {
+	configs, err := ParseMultilineConfigs(`[{"mode":"indent","timeout":"1m"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := NewMultilineRules(configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var emitted []string
+	m := NewMultiline(&Source{Name: "test", Multiline: rules}, func(data []byte, meta Metadata, _ time.Time) {
+		emitted = append(emitted, string(data))
+	})
+
+	steps := []struct {
+		line string
+		held int
+	}{
+		{"first", 1},
+		{"  continued", 2},
+		{"second", 1},
+		{"  continued", 2},
+		{"  continued", 3},
+	}
+	for _, step := range steps {
+		m.Add([]byte(step.line), nil)
+		if got := m.Held(); got != step.held {
+			t.Fatalf("after %q: Held() = %d, want %d", step.line, got, step.held)
+		}
+	}
+	m.Flush()
+	if got := m.Held(); got != 0 || len(emitted) != 2 {
+		t.Fatalf("after Flush: Held() = %d, emitted %q", got, emitted)
+	}
+}
+
+func TestPipelineRateLimitSummary(t *testing.T) {
+	router, path := testRouter(t)
+	pipeline := NewPipeline(router, 0, 0)
+	source := &Source{Name: "unix", Tag: "local", SyslogFormat: SyslogFormatAuto}
+	source.RateLimit = pipeline.NewRateLimiter(source, RateLimitConfig{Rate: 1, Burst: 1, By: "pid", SummaryInterval: time.Hour})
+	for i := 0; i < 3; i++ {
+		if err := pipeline.Process(source, []byte("<13>Oct 18 10:00:00 app: x"), Metadata{"pid": "42", "uid": "1000"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source.RateLimit.Stop()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want the message and a summary", len(records))
+	}
+	var message, summary marshaledRecord
+	if err := json.Unmarshal(records[0], &message); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(records[1], &summary); err != nil {
+		t.Fatal(err)
+	}
+	// The summary comes from its own source and does not carry the sender's credentials
+	if message.Listener != "unix" || summary.Listener != "unix/rate_limit" {
+		t.Errorf("listeners = %q, %q, want unix, unix/rate_limit", message.Listener, summary.Listener)
+	}
+	if want := `{"rate_limit_key":"pid=42","suppressed":"2"}`; string(summary.Attributes) != want {
+		t.Errorf("summary attributes = %s, want %s", summary.Attributes, want)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRateLimitKeys bounds the number of tracked senders; further senders share one bucket
+const maxRateLimitKeys = 10000
+
+// RateLimitConfig holds the token bucket options of a listener
+type RateLimitConfig struct {
+	Rate            float64       // Sustained messages per second per sender (0 = unlimited)
+	Burst           int           // Messages a sender may send at once
+	By              string        // Sender key: "auto", "pid", "uid", "remote_ip", "container", "tag" or "listener"
+	SummaryInterval time.Duration // How often suppressed message counts are reported
+}
+
+// NewRateLimitConfig validates a listener's rate limit. Empty values fall back to the
+// RATE_LIMIT, RATE_BURST, RATE_LIMIT_BY and RATE_SUMMARY_INTERVAL environment variables.
+func NewRateLimitConfig(rate *float64, burst int, by, summaryInterval string) (RateLimitConfig, error) {
+	config := RateLimitConfig{By: by}
+	if rate != nil {
+		config.Rate = *rate
+	} else if raw := os.Getenv("RATE_LIMIT"); raw != "" {
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return RateLimitConfig{}, fmt.Errorf("invalid RATE_LIMIT %q", raw)
+		}
+		config.Rate = value
+	}
+	if config.Rate < 0 {
+		return RateLimitConfig{}, fmt.Errorf("rate limit must not be negative")
+	}
+
+	if burst == 0 {
+		burst = getEnvInt("RATE_BURST", 0)
+	}
+	if burst < 0 {
+		return RateLimitConfig{}, fmt.Errorf("rate burst must not be negative")
+	}
+	if burst == 0 {
+		// Allow one second's worth of messages at once
+		burst = int(config.Rate)
+		if burst < 1 {
+			burst = 1
+		}
+	}
+	config.Burst = burst
+
+	if config.By == "" {
+		config.By = os.Getenv("RATE_LIMIT_BY")
+	}
+	switch config.By {
+	case "":
+		config.By = "auto"
+	case "auto", "pid", "uid", "remote_ip", "container", "tag", "listener":
+	default:
+		return RateLimitConfig{}, fmt.Errorf("unknown rate limit key %q (expected auto, pid, uid, remote_ip, container, tag or listener)", config.By)
+	}
+
+	config.SummaryInterval = getEnvDuration("RATE_SUMMARY_INTERVAL", 10*time.Second)
+	if summaryInterval != "" {
+		interval, err := time.ParseDuration(summaryInterval)
+		if err != nil {
+			return RateLimitConfig{}, fmt.Errorf("invalid rate_summary_interval %q: must be a positive duration (e.g. 10s, 1m)", summaryInterval)
+		}
+		config.SummaryInterval = interval
+	}
+	if config.SummaryInterval <= 0 {
+		return RateLimitConfig{}, fmt.Errorf("rate summary interval must be positive")
+	}
+	return config, nil
+}
+
+// RateLimiter applies a token bucket per sender, so one process flooding a socket cannot
+// starve the others. Suppressed messages are reported by a summary record per sender
+// and interval instead of disappearing silently.
+type RateLimiter struct {
+	source  *Source
+	config  RateLimitConfig
+	emit    func(data []byte, meta Metadata) // Queues summary records, bypassing the limit
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// rateBucket is the token bucket of one sender
+type rateBucket struct {
+	tokens     float64
+	last       time.Time
+	suppressed int
+}
+
+// NewRateLimiter starts a rate limiter for a source. It returns nil when the rate is
+// unlimited, in which case every message is allowed.
+func NewRateLimiter(source *Source, config RateLimitConfig, emit func(data []byte, meta Metadata)) *RateLimiter {
+	if config.Rate <= 0 {
+		return nil
+	}
+	l := &RateLimiter{
+		source:  source,
+		config:  config,
+		emit:    emit,
+		buckets: make(map[string]*rateBucket),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go l.run()
+	log.Printf("Rate limit on %s: %g messages/s per %s, burst %d", source.Name, config.Rate, config.By, config.Burst)
+	return l
+}
+
+// Allow takes a token from the sender's bucket and reports whether the message may pass
+func (l *RateLimiter) Allow(data []byte, meta Metadata) bool {
+	if l == nil {
+		return true
+	}
+	key := l.key(data, meta)
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket := l.buckets[key]
+	if bucket == nil {
+		if len(l.buckets) >= maxRateLimitKeys {
+			key = "other"
+			bucket = l.buckets[key]
+		}
+		if bucket == nil {
+			bucket = &rateBucket{tokens: float64(l.config.Burst), last: now}
+			l.buckets[key] = bucket
+		}
+	}
+
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.config.Rate
+	if burst := float64(l.config.Burst); bucket.tokens > burst {
+		bucket.tokens = burst
+	}
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true
+	}
+
+	if bucket.suppressed == 0 {
+		log.Printf("Rate limit exceeded on %s by %s, suppressing messages", l.source.Name, key)
+	}
+	bucket.suppressed++
+	RecordRateLimitedLog(l.source.Name)
+	return false
+}
+
+// key identifies the sender of a message. With "auto" it is the sending process for
+// Unix datagrams with credentials, the remote IP for network listeners, the container
+// for Kubernetes container logs, and the syslog tag otherwise.
+func (l *RateLimiter) key(data []byte, meta Metadata) string {
+	by := l.config.By
+	if by == "auto" {
+		switch {
+		case meta["pid"] != "":
+			by = "pid"
+		case meta["remote_ip"] != "":
+			by = "remote_ip"
+		case meta["container"] != "":
+			by = "container"
+		default:
+			by = "tag"
+		}
+	}
+
+	switch by {
+	case "pid", "uid", "remote_ip":
+		return by + "=" + meta[by]
+	case "container":
+		return "container=" + meta["namespace"] + "/" + meta["pod"] + "/" + meta["container"]
+	case "tag":
+		format := l.source.SyslogFormat
+		if format == SyslogFormatNone {
+			format = SyslogFormatAuto
+		}
+		tag := ""
+		if parsed, err := ParseSyslog(data, format); err == nil {
+			tag = parsed.AppName
+		}
+		return "tag=" + tag
+	}
+	return "listener=" + l.source.Name
+}
+
+// run emits summary records and forgets idle senders every summary interval
+func (l *RateLimiter) run() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.config.SummaryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			l.summarize(time.Now())
+			return
+		case now := <-ticker.C:
+			l.summarize(now)
+		}
+	}
+}
+
+// summarize emits a record for every sender with suppressed messages
+func (l *RateLimiter) summarize(now time.Time) {
+	type summary struct {
+		data []byte
+		meta Metadata
+	}
+	var summaries []summary
+	throttled := 0
+
+	l.mu.Lock()
+	// A bucket that refilled completely carries no state worth keeping
+	refill := time.Duration(float64(l.config.Burst) / l.config.Rate * float64(time.Second))
+	for key, bucket := range l.buckets {
+		if bucket.suppressed == 0 {
+			if now.Sub(bucket.last) >= refill {
+				delete(l.buckets, key)
+			}
+			continue
+		}
+		throttled++
+
+		data := fmt.Sprintf("<44>%s syslog-encryptor: %d messages suppressed from %s on %s (rate limit %g/s, burst %d)",
+			now.Format(time.RFC3339), bucket.suppressed, key, l.source.Name, l.config.Rate, l.config.Burst)
+		// The sender's own metadata is not copied, so a summary cannot pass for its message
+		meta := Metadata{"rate_limit_key": key, "suppressed": strconv.Itoa(bucket.suppressed)}
+		summaries = append(summaries, summary{[]byte(data), meta})
+
+		bucket.suppressed = 0
+	}
+	l.mu.Unlock()
+
+	SetRateLimitedSenders(l.source.Name, throttled)
+	for _, s := range summaries {
+		l.emit(s.data, s.meta)
+	}
+}
+
+// Stop emits the remaining summaries and stops the limiter
+func (l *RateLimiter) Stop() {
+	if l == nil {
+		return
+	}
+	l.once.Do(func() {
+		close(l.stop)
+		<-l.done
+	})
+}
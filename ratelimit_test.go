@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterKey(t *testing.T) {
+	tests := []struct {
+		by   string
+		data string
+		meta Metadata
+		want string
+	}{
+		{"auto", "<13>Oct 18 10:00:00 host app: x", Metadata{"pid": "42", "uid": "1000"}, "pid=42"},
+		{"auto", "<13>Oct 18 10:00:00 host app: x", Metadata{"remote_ip": "192.0.2.1", "remote_port": "514"}, "remote_ip=192.0.2.1"},
+		{"auto", "plain output", Metadata{"namespace": "shop", "pod": "web-1", "container": "nginx", "stream": "stdout"}, "container=shop/web-1/nginx"},
+		{"auto", "<13>Oct 18 10:00:00 host app: x", nil, "tag=app"},
+		{"uid", "x", Metadata{"pid": "42", "uid": "1000"}, "uid=1000"},
+		{"remote_ip", "x", Metadata{"remote_ip": "2001:db8::1"}, "remote_ip=2001:db8::1"},
+		{"listener", "x", Metadata{"pid": "42"}, "listener=test"},
+	}
+	for _, tt := range tests {
+		l := &RateLimiter{source: &Source{Name: "test", SyslogFormat: SyslogFormatAuto}, config: RateLimitConfig{By: tt.by}}
+		if got := l.key([]byte(tt.data), tt.meta); got != tt.want {
+			t.Errorf("key(%s, %q, %v) = %q, want %q", tt.by, tt.data, tt.meta, got, tt.want)
+		}
+	}
+}
+
+func TestCheckRateLimitKey(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		listener ListenerConfig
+		by       string
+		ok       bool
+	}{
+		{ListenerConfig{Type: "tcp"}, "remote_ip", true},
+		{ListenerConfig{Type: "tls"}, "remote_ip", true},
+		{ListenerConfig{Type: "udp"}, "remote_ip", true},
+		{ListenerConfig{Type: "unix_stream"}, "remote_ip", false},
+		{ListenerConfig{Type: "tcp"}, "pid", false},
+		{ListenerConfig{Type: "udp"}, "uid", false},
+		{ListenerConfig{Type: "unix", Credentials: &disabled}, "pid", false},
+		{ListenerConfig{Type: "cri"}, "container", true},
+		{ListenerConfig{Type: "file"}, "container", false},
+		{ListenerConfig{Type: "file"}, "tag", true},
+		{ListenerConfig{Type: "tcp"}, "listener", true},
+		{ListenerConfig{Type: "tcp"}, "auto", true},
+	}
+	for _, tt := range tests {
+		err := tt.listener.checkRateLimitKey(tt.by)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkRateLimitKey(%s on %s) = %v, want ok=%v", tt.by, tt.listener.Type, err, tt.ok)
+		}
+	}
+}
+
+func TestRateLimiterSummary(t *testing.T) {
+	type summary struct {
+		data string
+		meta Metadata
+	}
+	var summaries []summary
+	l := &RateLimiter{
+		source:  &Source{Name: "unix", SyslogFormat: SyslogFormatAuto},
+		config:  RateLimitConfig{Rate: 1, Burst: 1, By: "pid"},
+		emit:    func(data []byte, meta Metadata) { summaries = append(summaries, summary{string(data), meta}) },
+		buckets: make(map[string]*rateBucket),
+	}
+	sender := Metadata{"pid": "42", "uid": "1000", "gid": "1000"}
+	for i := 0; i < 4; i++ {
+		l.Allow([]byte("<13>Oct 18 10:00:00 app: x"), sender)
+	}
+	l.summarize(time.Now())
+
+	if len(summaries) != 1 {
+		t.Fatalf("got %d summaries, want 1", len(summaries))
+	}
+	// The summary names the sender but carries none of its metadata
+	want := Metadata{"rate_limit_key": "pid=42", "suppressed": "3"}
+	if got := summaries[0]; !strings.Contains(got.data, "3 messages suppressed from pid=42 on unix") || !reflect.DeepEqual(got.meta, want) {
+		t.Errorf("summary = %q %v, want metadata %v", got.data, got.meta, want)
+	}
+
+	summaries = nil
+	l.summarize(time.Now())
+	if len(summaries) != 0 {
+		t.Errorf("got %d summaries after the counts were reported, want 0", len(summaries))
+	}
+}
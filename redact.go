@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RedactPatternConfig describes a user-defined pattern from the REDACT_PATTERNS environment
+// variable. When the regex has capture groups, only the first group that matched is replaced.
+type RedactPatternConfig struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+}
+
+// RedactConfig holds the redaction options
+type RedactConfig struct {
+	Builtin  []string              // Built-in pattern names, or "all"
+	Patterns []RedactPatternConfig // User-defined patterns
+	Mode     string                // "marker" (default) or "hash"
+	Marker   string                // Replacement in marker mode
+	HashKey  string                // Hex-encoded 32-byte HMAC key for hash mode
+}
+
+// redactPattern is one compiled redaction pattern
+type redactPattern struct {
+	name     string
+	regex    *regexp.Regexp
+	validate func(match []byte) bool // Optional check that rejects false positives
+}
+
+// builtinRedactPatterns are the patterns selectable by name in REDACT_BUILTIN
+var builtinRedactPatterns = []*redactPattern{
+	{
+		// IDENTIFIED BY 'x', IDENTIFIED VIA ed25519 USING PASSWORD('x'), SET PASSWORD [FOR u] = 'x'
+		// and PASSWORD('x'). A quoted value may contain escaped (\' or '') quotes; in the MariaDB
+		// audit log the whole statement is escaped once more, so the value is quoted as \'x\'
+		// and its escaped quotes become \\\'.
+		name: "sql_password",
+		regex: regexp.MustCompile(`(?i)(?:IDENTIFIED\s+(?:(?:WITH|VIA)\s+\w+\s+)?(?:BY|USING)|SET\s+PASSWORD(?:\s+FOR\s+\S+)?\s*=|\bPASSWORD\s*\()\s*(?:PASSWORD\s*\(?\s*)?` +
+			`(?:'((?:[^'\\]|\\.|'')*)'|"((?:[^"\\]|\\.|"")*)"|` +
+			`\\'((?:[^'"\\]|\\"|\\\\(?:\\.|[^\\])|\\'\\')*)\\'|\\"((?:[^'"\\]|\\'|\\\\(?:\\.|[^\\])|\\"\\")*)\\")`),
+	},
+	{
+		// 13 to 19 digits, optionally grouped by spaces or dashes, with a card network's first
+		// digit (2-6), passing the Luhn check. Millisecond and microsecond epoch timestamps
+		// start with 1 and are not mistaken for card numbers.
+		name:     "credit_card",
+		regex:    regexp.MustCompile(`\b[2-6](?:[ -]?\d){12,18}\b`),
+		validate: luhnValid,
+	},
+	{
+		name:  "bearer_token",
+		regex: regexp.MustCompile(`(?i)\bBearer\s+([A-Za-z0-9\-._~+/]+=*)`),
+	},
+}
+
+// Redactor replaces secrets and personal data in messages before they are encrypted
+type Redactor struct {
+	patterns []*redactPattern
+	marker   []byte
+	hashKey  []byte // nil in marker mode
+}
+
+// ParseRedactPatternConfigs decodes the JSON array from the REDACT_PATTERNS environment variable
+func ParseRedactPatternConfigs(raw string) ([]RedactPatternConfig, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var configs []RedactPatternConfig
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		return nil, fmt.Errorf("invalid REDACT_PATTERNS JSON: %w", err)
+	}
+	return configs, nil
+}
+
+// NewRedactor validates the redaction options. It returns nil when no pattern is
+// configured, in which case messages are not inspected.
+func NewRedactor(config RedactConfig) (*Redactor, error) {
+	r := &Redactor{marker: []byte(config.Marker)}
+	if config.Marker == "" {
+		r.marker = []byte("[REDACTED]")
+	}
+
+	for _, name := range config.Builtin {
+		found := false
+		for _, pattern := range builtinRedactPatterns {
+			if name == "all" || name == pattern.name {
+				found = true
+				if !r.uses(pattern) {
+					r.patterns = append(r.patterns, pattern)
+				}
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown built-in pattern %q (expected sql_password, credit_card, bearer_token or all)", name)
+		}
+	}
+	for i, cfg := range config.Patterns {
+		name := cfg.Name
+		if name == "" {
+			name = fmt.Sprintf("pattern%d", i+1)
+		}
+		regex, err := regexp.Compile(cfg.Pattern)
+		if err != nil || cfg.Pattern == "" {
+			return nil, fmt.Errorf("pattern %s: invalid regex %q", name, cfg.Pattern)
+		}
+		r.patterns = append(r.patterns, &redactPattern{name: name, regex: regex})
+	}
+
+	switch config.Mode {
+	case "", "marker":
+	case "hash":
+		key, err := parseKeyHex(config.HashKey)
+		if err != nil {
+			return nil, fmt.Errorf("hash mode requires a 32-byte hex REDACT_HASH_KEY: %w", err)
+		}
+		r.hashKey = key[:]
+	default:
+		return nil, fmt.Errorf("unknown mode %q (expected marker or hash)", config.Mode)
+	}
+
+	if len(r.patterns) == 0 {
+		return nil, nil
+	}
+	names := make([]string, len(r.patterns))
+	for i, pattern := range r.patterns {
+		names[i] = pattern.name
+	}
+	mode := "marker"
+	if r.hashKey != nil {
+		mode = "hash"
+	}
+	log.Printf("Redacting %s (mode=%s)", strings.Join(names, ", "), mode)
+	return r, nil
+}
+
+// uses reports whether a built-in pattern was already selected
+func (r *Redactor) uses(pattern *redactPattern) bool {
+	for _, p := range r.patterns {
+		if p == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// redaction is a secret found in a message by the pattern at index
+type redaction struct {
+	start, end int
+	index      int
+}
+
+// Redact replaces the matches of every pattern in the message. All patterns search the
+// original message, so a replacement is never matched again; where matches overlap, the
+// one starting first is replaced (on a tie, that of the earlier pattern). The message
+// data is only copied when something was replaced.
+func (r *Redactor) Redact(msg *LogMessage) {
+	if r == nil {
+		return
+	}
+	var found []redaction
+	for i, pattern := range r.patterns {
+		found = pattern.find(msg.Data, i, found)
+	}
+	if len(found) == 0 {
+		return
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].start < found[j].start })
+
+	var out []byte
+	counts := make([]int, len(r.patterns))
+	last := 0
+	for _, secret := range found {
+		if secret.start < last {
+			continue
+		}
+		out = append(out, msg.Data[last:secret.start]...)
+		out = append(out, r.replacement(msg.Data[secret.start:secret.end])...)
+		last = secret.end
+		counts[secret.index]++
+	}
+	msg.Data = append(out, msg.Data[last:]...)
+
+	for i, count := range counts {
+		if count > 0 {
+			RecordRedactions(msg.Source.Name, r.patterns[i].name, count)
+		}
+	}
+}
+
+// find appends the secrets matched by the pattern to found
+func (p *redactPattern) find(data []byte, index int, found []redaction) []redaction {
+	for _, match := range p.regex.FindAllSubmatchIndex(data, -1) {
+		// The first capture group that matched, if any, is the secret
+		start, end := match[0], match[1]
+		for group := 2; group < len(match); group += 2 {
+			if match[group] >= 0 {
+				start, end = match[group], match[group+1]
+				break
+			}
+		}
+		if start == end || (p.validate != nil && !p.validate(data[start:end])) {
+			continue
+		}
+		found = append(found, redaction{start: start, end: end, index: index})
+	}
+	return found
+}
+
+// replacement returns the marker, or in hash mode a keyed hash of the secret so equal
+// values can be correlated without revealing them
+func (r *Redactor) replacement(secret []byte) []byte {
+	if r.hashKey == nil {
+		return r.marker
+	}
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write(secret)
+	sum := mac.Sum(nil)
+	return []byte("[REDACTED:" + hex.EncodeToString(sum[:8]) + "]")
+}
+
+// luhnValid reports whether the digits of a candidate card number pass the Luhn check
+func luhnValid(number []byte) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"sync"
+)
+
+// RouteConfig describes a single routing rule from the ROUTES environment variable.
+// All non-empty match fields must match for the rule to apply.
+type RouteConfig struct {
+	Name      string `json:"name"`
+	Tag       string `json:"tag"`      // app-name/tag glob (e.g. "mysqld", "app-*")
+	Facility  string `json:"facility"` // facility name or number (e.g. "local0")
+	Pattern   string `json:"pattern"`  // regex matched against the raw message
+	Listener  string `json:"listener"` // listener routing tag glob (e.g. "dmz-*")
+	PublicKey string `json:"public_key"`
+	Output    string `json:"output"` // file path or "<type>:<target>", empty or "-" for stdout
+}
+
+// Route selects the recipient and output for matching messages
+type Route struct {
+	name      string
+	tag       string
+	facility  int // -1 matches any facility
+	pattern   *regexp.Regexp
+	listener  string
+	encryptor *Encryptor
+	output    OutputSink
+}
+
+// Router encrypts each message to the recipient of the first matching route,
+// after dropping messages excluded by the filter rules and redacting secrets
+type Router struct {
+	filters      []*FilterRule
+	redactor     *Redactor
+	labels       *Labels
+	routes       []*Route
+	defaultRoute *Route
+	outputs      map[string]*BufferedOutput // By canonical output name
+	closeOnce    sync.Once
+}
+
+// ParseRouteConfigs decodes the JSON array from the ROUTES environment variable
+func ParseRouteConfigs(raw string) ([]RouteConfig, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	var configs []RouteConfig
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		return nil, fmt.Errorf("invalid ROUTES JSON: %w", err)
+	}
+	return configs, nil
+}
+
+// NewRouter builds a router from route configs. Messages that match no route
+// are encrypted with defaultEncryptor and written to the default output. Every
+// output batches records according to outputConfig and carries labels, if any.
+func NewRouter(privateKey [32]byte, defaultEncryptor *Encryptor, configs []RouteConfig, filters []*FilterRule, redactor *Redactor, labels *Labels, outputConfig OutputConfig) (*Router, error) {
+	r := &Router{
+		filters:  filters,
+		redactor: redactor,
+		labels:   labels,
+		outputs:  make(map[string]*BufferedOutput),
+	}
+	output, err := r.output(outputConfig.Default, outputConfig)
+	if err != nil {
+		return nil, fmt.Errorf("default output: %w", err)
+	}
+	r.defaultRoute = &Route{facility: -1, encryptor: defaultEncryptor, output: output}
+
+	for i, cfg := range configs {
+		name := cfg.Name
+		if name == "" {
+			name = fmt.Sprintf("route%d", i+1)
+		}
+
+		route := &Route{name: name, tag: cfg.Tag, facility: -1, listener: cfg.Listener}
+
+		if cfg.Tag != "" {
+			if _, err := path.Match(cfg.Tag, ""); err != nil {
+				r.Close()
+				return nil, fmt.Errorf("route %s: invalid tag pattern: %w", name, err)
+			}
+		}
+
+		if cfg.Listener != "" {
+			if _, err := path.Match(cfg.Listener, ""); err != nil {
+				r.Close()
+				return nil, fmt.Errorf("route %s: invalid listener pattern: %w", name, err)
+			}
+		}
+
+		if cfg.Facility != "" {
+			facility, ok := ParseFacility(cfg.Facility)
+			if !ok {
+				r.Close()
+				return nil, fmt.Errorf("route %s: unknown facility %q", name, cfg.Facility)
+			}
+			route.facility = facility
+		}
+
+		if cfg.Pattern != "" {
+			pattern, err := regexp.Compile(cfg.Pattern)
+			if err != nil {
+				r.Close()
+				return nil, fmt.Errorf("route %s: invalid pattern: %w", name, err)
+			}
+			route.pattern = pattern
+		}
+
+		publicKey, err := parseKeyHex(cfg.PublicKey)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("route %s: invalid public_key: %w", name, err)
+		}
+		encryptor, err := NewEncryptor(privateKey)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("route %s: %w", name, err)
+		}
+		if err := encryptor.SetupSharedSecret(publicKey); err != nil {
+			r.Close()
+			return nil, fmt.Errorf("route %s: %w", name, err)
+		}
+		route.encryptor = encryptor
+
+		output, err := r.output(cfg.Output, outputConfig)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("route %s: %w", name, err)
+		}
+		route.output = output
+
+		log.Printf("Route %s: tag=%q facility=%q pattern=%q listener=%q recipient=%x", name, cfg.Tag, cfg.Facility, cfg.Pattern, cfg.Listener, publicKey)
+		r.routes = append(r.routes, route)
+	}
+
+	return r, nil
+}
+
+// output returns the buffered sink of an output, opening it on first use. Routes
+// sharing an output share one sink.
+func (r *Router) output(name string, config OutputConfig) (*BufferedOutput, error) {
+	key, err := parseOutput(name)
+	if err != nil {
+		return nil, err
+	}
+	if output, ok := r.outputs[key]; ok {
+		return output, nil
+	}
+	sink, err := NewOutputSink(key)
+	if err != nil {
+		return nil, err
+	}
+	output := NewBufferedOutput(key, sink, config)
+	if err := output.Open(); err != nil {
+		return nil, fmt.Errorf("failed to open output %s: %w", key, err)
+	}
+	r.outputs[key] = output
+	return output, nil
+}
+
+// Match returns the first route matching the message, or the default route
+func (r *Router) Match(msg *LogMessage) *Route {
+	if len(r.routes) == 0 {
+		return r.defaultRoute
+	}
+
+	facility, tag := msg.Header()
+	for _, route := range r.routes {
+		if route.matches(msg, facility, tag) {
+			return route
+		}
+	}
+	return r.defaultRoute
+}
+
+func (route *Route) matches(msg *LogMessage, facility int, tag string) bool {
+	if route.listener != "" {
+		if ok, _ := path.Match(route.listener, msg.Source.Tag); !ok {
+			return false
+		}
+	}
+	if route.facility >= 0 && route.facility != facility {
+		return false
+	}
+	if route.tag != "" {
+		if ok, _ := path.Match(route.tag, tag); !ok {
+			return false
+		}
+	}
+	if route.pattern != nil && !route.pattern.Match(msg.Data) {
+		return false
+	}
+	return true
+}
+
+// Process routes, encrypts and outputs a single message with its authenticated metadata
+func (r *Router) Process(msg *LogMessage) error {
+	if filtered(r.filters, msg) {
+		return nil
+	}
+	r.redactor.Redact(msg)
+	route := r.Match(msg)
+	RecordRoutedLog(route.name)
+	return encryptAndOutput(route.encryptor, msg, route.name, r.labels, route.output)
+}
+
+// AppendRecord routes and encrypts a message, appending the output record to dst
+// and returning it with its destination. The destination is nil for filtered messages.
+func (r *Router) AppendRecord(dst []byte, msg *LogMessage) ([]byte, OutputSink, error) {
+	if filtered(r.filters, msg) {
+		return dst, nil, nil
+	}
+	r.redactor.Redact(msg)
+	route := r.Match(msg)
+	RecordRoutedLog(route.name)
+	record, err := appendRecord(dst, route.encryptor, msg, route.name, r.labels)
+	return record, route.output, err
+}
+
+// Flush writes the records buffered for every output sink
+func (r *Router) Flush() error {
+	var errs []error
+	for _, output := range r.outputs {
+		if err := output.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close flushes buffered records and closes every output sink
+func (r *Router) Close() {
+	r.closeOnce.Do(func() {
+		for _, output := range r.outputs {
+			if err := output.Close(); err != nil {
+				log.Printf("Error closing output: %v", err)
+			}
+		}
+	})
+}
+
+// parseKeyHex decodes a 32-byte hex-encoded X25519 key
+func parseKeyHex(keyHex string) ([32]byte, error) {
+	var key [32]byte
+	keyBytes, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return key, err
+	}
+	if len(keyBytes) != 32 {
+		return key, fmt.Errorf("must be exactly 32 bytes (64 hex characters)")
+	}
+	copy(key[:], keyBytes)
+	return key, nil
+}
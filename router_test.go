@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRouterMatch(t *testing.T) {
+	encryptor := testEncryptor(t)
+	publicKey := hex.EncodeToString(encryptor.publicKey[:])
+	routes := []RouteConfig{
+		{Name: "dmz", Listener: "dmz-*"},
+		{Name: "mysql", Tag: "mysqld"},
+		{Name: "app-local1", Tag: "app-*", Facility: "local1"},
+		{Name: "local0", Facility: "16"},
+		{Name: "alerts", Pattern: `ALERT \d+`},
+	}
+	for i := range routes {
+		routes[i].PublicKey = publicKey
+	}
+	router, err := NewRouter(encryptor.privateKey, encryptor, routes, nil, nil, nil, OutputConfig{Default: "stdout"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Close()
+
+	tests := []struct {
+		listener string // Routing tag of the source
+		data     string
+		want     string // Route name, empty for the default route
+	}{
+		// Routes are tried in order, so the listener route wins over the tag route
+		{"dmz-web", "<134>Oct 18 10:00:00 host mysqld[1]: query", "dmz"},
+		{"lan", "<134>Oct 18 10:00:00 host mysqld[1]: query", "mysql"},
+		{"", "<1>1 2024-10-18T10:00:00Z host mysqld 1 - - query", "mysql"},
+		{"", "<138>Oct 18 10:00:00 host app-api: request", "app-local1"},
+		{"", "<134>Oct 18 10:00:00 host app-api: request", "local0"},
+		{"", "<150>Oct 18 10:00:00 host app-api: request", ""},
+		{"", "<14>Oct 18 10:00:00 host cron: ALERT 42", "alerts"},
+		{"", "<14>Oct 18 10:00:00 host cron: ALERT", ""},
+
+		// Messages that are not syslog only match listener and pattern routes
+		{"", "mysqld query", ""},
+		{"", "ALERT 7 from a plain writer", "alerts"},
+		{"dmz-db", "plain text", "dmz"},
+	}
+	for _, tt := range tests {
+		source := &Source{Name: "test", Tag: tt.listener, SyslogFormat: SyslogFormatNone}
+		if got := router.Match(source.NewMessage([]byte(tt.data), nil)).name; got != tt.want {
+			t.Errorf("Match(%q on %q) = route %q, want %q", tt.data, tt.listener, got, tt.want)
+		}
+	}
+}
+
+func TestRouterRecipients(t *testing.T) {
+	sender := testEncryptor(t)
+	var recipientKey [32]byte
+	recipientKey[1] = 1 // The low bits of byte 0 are clamped away
+	recipient, err := NewEncryptor(recipientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := recipient.SetupSharedSecret(sender.publicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	routedPath := filepath.Join(dir, "mysql.json")
+	defaultPath := filepath.Join(dir, "default.json")
+	routes := []RouteConfig{{Name: "mysql", Tag: "mysqld", PublicKey: hex.EncodeToString(recipient.publicKey[:]), Output: routedPath}}
+	router, err := NewRouter(sender.privateKey, sender, routes, nil, nil, nil, OutputConfig{Default: defaultPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &Source{Name: "test", SyslogFormat: SyslogFormatAuto}
+	for _, data := range []string{"<134>Oct 18 10:00:00 host mysqld[1]: query", "<134>Oct 18 10:00:00 host sshd[1]: login"} {
+		if err := router.Process(source.NewMessage([]byte(data), nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	router.Close()
+
+	// Each record opens only with the key of its own recipient
+	tests := []struct {
+		path      string
+		opener    *Encryptor
+		other     *Encryptor
+		wantData  string
+		wantRoute string
+	}{
+		{routedPath, recipient, sender, "<134>Oct 18 10:00:00 host mysqld[1]: query", `"r":"mysql"`},
+		{defaultPath, sender, recipient, "<134>Oct 18 10:00:00 host sshd[1]: login", ""},
+	}
+	for _, tt := range tests {
+		record, err := os.ReadFile(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record = bytes.TrimSuffix(record, []byte("\n"))
+		message, err := openRecord(tt.opener, record)
+		if err != nil || message != tt.wantData {
+			t.Errorf("%s: decrypted %q, %v, want %q", tt.path, message, err, tt.wantData)
+		}
+		if _, err := openRecord(tt.other, record); err == nil {
+			t.Errorf("%s: record opened with the other recipient's key", tt.path)
+		}
+		if tt.wantRoute != "" && !bytes.Contains(record, []byte(tt.wantRoute)) {
+			t.Errorf("%s: record %s does not name route %s", tt.path, record, tt.wantRoute)
+		}
+	}
+}
+
+func TestNewRouterErrors(t *testing.T) {
+	encryptor := testEncryptor(t)
+	publicKey := hex.EncodeToString(encryptor.publicKey[:])
+	tests := []RouteConfig{
+		{Tag: "app-[", PublicKey: publicKey},
+		{Listener: "[", PublicKey: publicKey},
+		{Facility: "local9", PublicKey: publicKey},
+		{Pattern: "(", PublicKey: publicKey},
+		{PublicKey: ""},
+		{PublicKey: publicKey[:62]},
+		{PublicKey: "zz" + publicKey[2:]},
+		{PublicKey: publicKey, Output: "s3://bucket/audit"},
+	}
+	for _, cfg := range tests {
+		router, err := NewRouter(encryptor.privateKey, encryptor, []RouteConfig{cfg}, nil, nil, nil, OutputConfig{Default: "stdout"})
+		if err == nil {
+			router.Close()
+			t.Errorf("NewRouter(%+v) succeeded, want error", cfg)
+		}
+	}
+}
@@ -11,6 +11,7 @@ PROJECT_DIR="$(dirname "$SCRIPT_DIR")"
 # Configuration
 INPUT_FILE="/tmp/speedtest_input.txt"
 OUTPUT_FILE="/tmp/speedtest_output.txt"
+UNBUFFERED_OUTPUT_FILE="/tmp/speedtest_output_unbuffered.txt"
 NUM_LINES=1000000
 LINE_LENGTH=1024
 
@@ -95,6 +96,18 @@ echo "Lines per second: $lines_per_second"
 echo "Throughput: ${mb_per_second} MB/s"
 echo "Success rate: $(echo "scale=1; $output_lines * 100 / $actual_lines" | bc -l)%"
 
+# Compare against unbuffered output (one write syscall per record)
+echo
+echo -e "${BLUE}⚡ Running unbuffered comparison (OUTPUT_BUFFER_SIZE=0)...${NC}"
+start_time=$(date +%s.%N)
+cat "$INPUT_FILE" | STDIN_MODE=1 OUTPUT_BUFFER_SIZE=0 ./syslog-encryptor > "$UNBUFFERED_OUTPUT_FILE"
+end_time=$(date +%s.%N)
+unbuffered_time=$(echo "$end_time - $start_time" | bc -l)
+unbuffered_lines_per_second=$(echo "scale=2; $(wc -l < "$UNBUFFERED_OUTPUT_FILE") / $unbuffered_time" | bc -l)
+echo "Unbuffered lines per second: $unbuffered_lines_per_second"
+echo "Buffered speedup: $(echo "scale=2; $lines_per_second / $unbuffered_lines_per_second" | bc -l)x"
+rm -f "$UNBUFFERED_OUTPUT_FILE"
+
 # Verify output format
 echo
 echo -e "${BLUE}🔍 OUTPUT VERIFICATION${NC}"
@@ -1,25 +1,50 @@
 package main
 
 import (
+	"bytes"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
+	"strconv"
 	"sync"
+	"time"
 )
 
+// UnixSocketConfig holds options for the Unix datagram socket
+type UnixSocketConfig struct {
+	Permissions    SocketPermissions // Mode and ownership of the socket file
+	Credentials    bool              // Capture sender PID/UID/GID via SCM_CREDENTIALS
+	CredentialsExe bool              // Also resolve the sender's executable path from /proc
+	AllowedUIDs    map[uint32]bool   // Only accept datagrams from these UIDs (nil = any); requires Credentials
+	ReadBuffer     int               // Kernel receive buffer in bytes (0 = kernel default)
+	StatsInterval  time.Duration     // How often receive queue and drop counters are exported (0 = never)
+	Journal        bool              // Datagrams use the native journal protocol (converted to JSON entries)
+}
+
 // Unix Socket Server for direct syslog integration
 type UnixSyslogServer struct {
-	encryptor   *Encryptor
+	pipeline    *Pipeline
+	source      *Source
 	socketPath  string
-	listener    net.PacketConn
+	config      UnixSocketConfig
+	multiline   *Multiline // Reassembles multi-line records (nil = disabled)
+	mu          sync.Mutex // Guards listener and inherited, set while Cleanup may run
+	listener    *net.UnixConn
+	inherited   bool      // Socket was passed in pre-opened; its file is not ours to remove
 	cleanupOnce sync.Once // Ensure cleanup happens exactly once during shutdown
 }
 
-func NewUnixSyslogServer(socketPath string, encryptor *Encryptor) *UnixSyslogServer {
+func NewUnixSyslogServer(socketPath string, pipeline *Pipeline, source *Source, config UnixSocketConfig) *UnixSyslogServer {
 	return &UnixSyslogServer{
-		encryptor:  encryptor,
+		pipeline:   pipeline,
+		source:     source,
 		socketPath: socketPath,
+		config:     config,
+		multiline:  newDatagramMultiline(pipeline, source),
 	}
 }
 
@@ -30,65 +55,158 @@ func (s *UnixSyslogServer) Start() error {
 	}
 
 	// Create Unix domain datagram socket (SOCK_DGRAM)
-	listener, err := net.ListenPacket("unixgram", s.socketPath)
+	listener, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: s.socketPath, Net: "unixgram"})
 	if err != nil {
 		return fmt.Errorf("failed to create Unix datagram socket: %w", err)
 	}
+
+	// Set socket mode and ownership so only intended applications can write to it
+	if err := s.config.Permissions.Apply(s.socketPath); err != nil {
+		listener.Close()
+		os.RemoveAll(s.socketPath)
+		return err
+	}
+
+	log.Printf("Unix syslog encryptor listening on %s (SOCK_DGRAM, mode %04o)", s.socketPath, s.config.Permissions.Mode)
+	return s.serve(listener)
+}
+
+// ServeInherited reads from a pre-opened datagram socket (systemd socket activation or an
+// inherited descriptor). The socket file is left in place on shutdown so datagrams queued
+// in the kernel buffer survive a restart.
+func (s *UnixSyslogServer) ServeInherited(conn *net.UnixConn) error {
+	s.mu.Lock()
+	s.inherited = true
+	s.mu.Unlock()
+	log.Printf("Unix syslog encryptor listening on inherited socket %s (SOCK_DGRAM)", conn.LocalAddr())
+	return s.serve(conn)
+}
+
+func (s *UnixSyslogServer) serve(listener *net.UnixConn) error {
+	s.mu.Lock()
 	s.listener = listener
+	s.mu.Unlock()
 	defer s.Cleanup()
 
-	// Set socket permissions so applications can write to it
-	if err := os.Chmod(s.socketPath, 0666); err != nil {
-		return fmt.Errorf("failed to set socket permissions: %w", err)
+	// Ask the kernel to attach sender credentials to every datagram
+	oob := make([]byte, credentialsOOBSize)
+	if s.config.Credentials {
+		if err := enablePassCred(listener); err != nil {
+			return fmt.Errorf("failed to enable credentials passing: %w", err)
+		}
 	}
 
-	log.Printf("Unix syslog encryptor listening on %s (SOCK_DGRAM)", s.socketPath)
+	// A larger kernel buffer absorbs bursts; datagrams that do not fit are lost
+	if err := configureReadBuffer(s.source.Name, listener, s.config.ReadBuffer); err != nil {
+		return fmt.Errorf("failed to set Unix datagram read buffer: %w", err)
+	}
+	go monitorSocketStats(s.source.Name, listener, s.config.StatsInterval)
 
 	// Handle datagram packets
 	buffer := make([]byte, 65536) // Max UDP packet size
 	for {
-		n, addr, err := listener.ReadFrom(buffer)
+		n, oobn, _, _, err := listener.ReadMsgUnix(buffer, oob)
 		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
 			log.Printf("Error reading from Unix datagram socket: %v", err)
 			continue
 		}
 
+		// Credentials are authenticated metadata: the kernel vouches for them, unlike the tag
+		var meta Metadata
+		if s.config.Credentials {
+			creds, ok := parseCredentials(oob[:oobn])
+			if !s.allowed(creds, ok) {
+				continue
+			}
+			if ok {
+				meta = creds.Metadata(s.config.CredentialsExe)
+			}
+		}
+
 		// Process the packet directly (no goroutine needed for fast encryption operations)
-		s.handleUnixPacket(buffer[:n], addr)
+		s.handleUnixPacket(buffer[:n], meta)
 	}
 }
 
-func (s *UnixSyslogServer) handleUnixPacket(data []byte, addr net.Addr) {
+// allowed enforces the peer UID allow-list, counting rejected datagrams
+func (s *UnixSyslogServer) allowed(creds *Credentials, ok bool) bool {
+	if s.config.AllowedUIDs == nil {
+		return true
+	}
+	if !ok {
+		RecordRejectedDatagram(s.source.Name, "no_credentials")
+		return false
+	}
+	if !s.config.AllowedUIDs[creds.UID] {
+		RecordRejectedDatagram(s.source.Name, "uid_not_allowed")
+		return false
+	}
+	return true
+}
+
+func (s *UnixSyslogServer) handleUnixPacket(data []byte, meta Metadata) {
+	if s.config.Journal {
+		// Each datagram is one entry; its fields and message are encrypted together
+		entry, err := parseJournalDatagram(data, meta)
+		if err != nil {
+			RecordRejectedDatagram(s.source.Name, "invalid_journal_entry")
+			return
+		}
+		processDatagram(s.pipeline, s.multiline, s.source, entry, meta)
+		return
+	}
+
 	// For SOCK_DGRAM, each packet is a complete message
 	// Use consistent newline handling
 	data = StripTrailingNewline(data)
 
-	if err := s.processUnixMessage(data); err != nil {
-		log.Printf("Error processing Unix packet from %v: %v", addr, err)
-	}
+	processDatagram(s.pipeline, s.multiline, s.source, data, meta)
 }
 
-func (s *UnixSyslogServer) processUnixMessage(data []byte) error {
+// newDatagramMultiline creates the reassembler of a datagram listener, which emits
+// complete records into the pipeline
+func newDatagramMultiline(pipeline *Pipeline, source *Source) *Multiline {
+	return NewMultiline(source, func(data []byte, meta Metadata, _ time.Time) {
+		pipeline.Offer(source, data, meta)
+	})
+}
+
+// processDatagram is the processing path shared by the Unix and UDP datagram servers
+func processDatagram(pipeline *Pipeline, multiline *Multiline, source *Source, data []byte, meta Metadata) {
 	// Record metrics for processed message
-	RecordProcessedLog(len(data))
+	RecordProcessedLog(source.Name, len(data))
 	
 	// Message already has correct format (\n preserved, \x00 discarded by parser)
-	if err := encryptAndOutput(s.encryptor, data); err != nil {
-		return fmt.Errorf("failed to encrypt and output message: %w", err)
+	// The read buffer is reused, so the pipeline queues a copy; when the queue is
+	// full the datagram is dropped and counted rather than stalling the socket
+	for _, message := range source.Limit.Apply(source.Name, data) {
+		if multiline != nil {
+			multiline.Add(message, meta)
+			continue
+		}
+		pipeline.Offer(source, message, meta)
 	}
-	
-	return nil
 }
 
 // Cleanup closes the listener and removes the socket file
 func (s *UnixSyslogServer) Cleanup() {
 	s.cleanupOnce.Do(func() {
-		if s.listener != nil {
+		s.mu.Lock()
+		listener, inherited := s.listener, s.inherited
+		s.mu.Unlock()
+
+		if listener != nil {
 			log.Printf("Closing Unix datagram socket...")
-			s.listener.Close()
+			listener.Close()
+		}
+		if s.multiline != nil {
+			s.multiline.Flush()
 		}
 		
-		if s.socketPath != "" {
+		if s.socketPath != "" && !inherited {
 			log.Printf("Removing socket file: %s", s.socketPath)
 			if err := os.RemoveAll(s.socketPath); err != nil {
 				log.Printf("Error removing socket file: %v", err)
@@ -96,3 +214,375 @@ func (s *UnixSyslogServer) Cleanup() {
 		}
 	})
 }
+
+// UDP Server for network devices and legacy daemons sending RFC 3164 over UDP/514
+type UDPSyslogServer struct {
+	pipeline      *Pipeline
+	source        *Source
+	addr          string
+	readBuffer    int           // SO_RCVBUF size in bytes (0 = kernel default)
+	statsInterval time.Duration // How often receive queue and drop counters are exported (0 = never)
+	multiline     *Multiline    // Reassembles multi-line records (nil = disabled)
+	mu            sync.Mutex    // Guards conn, set while Cleanup may run
+	conn          *net.UDPConn
+	cleanupOnce   sync.Once
+}
+
+func NewUDPSyslogServer(addr string, pipeline *Pipeline, source *Source, readBuffer int, statsInterval time.Duration) *UDPSyslogServer {
+	return &UDPSyslogServer{
+		pipeline:      pipeline,
+		source:        source,
+		addr:          addr,
+		readBuffer:    readBuffer,
+		statsInterval: statsInterval,
+		multiline:     newDatagramMultiline(pipeline, source),
+	}
+}
+
+func (s *UDPSyslogServer) Start() error {
+	udpAddr, err := net.ResolveUDPAddr("udp", s.addr)
+	if err != nil {
+		return fmt.Errorf("invalid UDP address: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to create UDP socket: %w", err)
+	}
+	return s.Serve(conn)
+}
+
+// Serve reads datagrams from an open UDP socket until it is closed
+func (s *UDPSyslogServer) Serve(conn *net.UDPConn) error {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	defer s.Cleanup()
+
+	// Larger kernel buffers absorb bursts from network devices
+	if err := configureReadBuffer(s.source.Name, conn, s.readBuffer); err != nil {
+		return fmt.Errorf("failed to set UDP read buffer: %w", err)
+	}
+	go monitorSocketStats(s.source.Name, conn, s.statsInterval)
+
+	log.Printf("UDP syslog encryptor listening on %s", conn.LocalAddr())
+
+	buffer := make([]byte, 65536) // Max UDP packet size
+	for {
+		n, addr, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Printf("Error reading from UDP socket: %v", err)
+			continue
+		}
+
+		// Record the sender so records from different devices can be told apart
+		meta := Metadata{
+			"remote_ip":   addr.IP.String(),
+			"remote_port": strconv.Itoa(addr.Port),
+		}
+		processDatagram(s.pipeline, s.multiline, s.source, StripTrailingNewline(buffer[:n]), meta)
+	}
+}
+
+// Cleanup closes the UDP socket
+func (s *UDPSyslogServer) Cleanup() {
+	s.cleanupOnce.Do(func() {
+		s.mu.Lock()
+		conn := s.conn
+		s.mu.Unlock()
+
+		if conn != nil {
+			log.Printf("Closing UDP socket...")
+			conn.Close()
+		}
+		if s.multiline != nil {
+			s.multiline.Flush()
+		}
+	})
+}
+
+// StreamConfig holds framing options and connection limits for stream syslog servers
+type StreamConfig struct {
+	Framing           Framing       // Frame detection mode (auto handles both RFC 6587 methods)
+	Delimiter         byte          // Delimiter for non-transparent framing (LF or NUL)
+	MaxConnections    int           // Maximum concurrent connections (0 = unlimited)
+	MaxConnectionsPer int           // Maximum concurrent connections per remote IP (0 = unlimited)
+	IdleTimeout       time.Duration // Close connections idle for longer than this (0 = never)
+	MaxFrameSize      int           // Maximum octet-counted frame size in bytes
+}
+
+// Stream Server for connection-oriented syslog: TCP from remote forwarders (rsyslog,
+// syslog-ng), optionally over TLS (RFC 5425), and Unix SOCK_STREAM sockets
+type StreamSyslogServer struct {
+	pipeline    *Pipeline
+	source      *Source
+	kind        string            // Listener kind for logs and metrics: "tcp", "tls" or "unix_stream"
+	permissions SocketPermissions // Unix socket file mode and ownership
+	inherited   bool              // Listener was passed in pre-opened; its socket file is not ours to remove
+	network     string
+	addr        string
+	config      StreamConfig
+	tlsConfig   *tls.Config
+	allowed     []string // Allowed client CN/SAN patterns, used to pick the recorded identity
+	listener    net.Listener
+	mu          sync.Mutex
+	conns       map[net.Conn]struct{}
+	perIP       map[string]int
+	wg          sync.WaitGroup
+	cleanupOnce sync.Once
+}
+
+func newStreamSyslogServer(kind, network, addr string, pipeline *Pipeline, source *Source, config StreamConfig) *StreamSyslogServer {
+	return &StreamSyslogServer{
+		pipeline: pipeline,
+		source:   source,
+		kind:     kind,
+		network:  network,
+		addr:     addr,
+		config:   config,
+		conns:    make(map[net.Conn]struct{}),
+		perIP:    make(map[string]int),
+	}
+}
+
+// NewTCPSyslogServer creates a plain TCP stream server
+func NewTCPSyslogServer(addr string, pipeline *Pipeline, source *Source, config StreamConfig) *StreamSyslogServer {
+	return newStreamSyslogServer("tcp", "tcp", addr, pipeline, source, config)
+}
+
+// NewTLSSyslogServer creates a TCP server that requires TLS on every connection
+func NewTLSSyslogServer(addr string, pipeline *Pipeline, source *Source, config StreamConfig, reloader *CertReloader) *StreamSyslogServer {
+	s := newStreamSyslogServer("tls", "tcp", addr, pipeline, source, config)
+	s.tlsConfig = reloader.TLSConfig()
+	s.allowed = reloader.files.AllowedClients
+	return s
+}
+
+// NewUnixStreamSyslogServer creates a Unix domain SOCK_STREAM server
+func NewUnixStreamSyslogServer(socketPath string, pipeline *Pipeline, source *Source, config StreamConfig, permissions SocketPermissions) *StreamSyslogServer {
+	s := newStreamSyslogServer("unix_stream", "unix", socketPath, pipeline, source, config)
+	s.permissions = permissions
+	return s
+}
+
+func (s *StreamSyslogServer) Start() error {
+	if s.network == "unix" {
+		// Remove existing socket file if it exists
+		if err := os.RemoveAll(s.addr); err != nil {
+			return fmt.Errorf("failed to remove existing socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen(s.network, s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to create %s listener: %w", s.kind, err)
+	}
+
+	if s.network == "unix" {
+		// Socket file is removed in Cleanup rather than on Close
+		listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+		// Set socket mode and ownership so only intended applications can connect
+		if err := s.permissions.Apply(s.addr); err != nil {
+			listener.Close()
+			return err
+		}
+	}
+
+	return s.Serve(listener)
+}
+
+// ServeInherited accepts connections on a pre-opened listener (systemd socket activation
+// or an inherited descriptor) and leaves its socket file in place on shutdown
+func (s *StreamSyslogServer) ServeInherited(listener net.Listener) error {
+	s.inherited = true
+	return s.Serve(listener)
+}
+
+// Serve accepts syslog connections on an existing listener until it is closed
+func (s *StreamSyslogServer) Serve(listener net.Listener) error {
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+	defer s.Cleanup()
+
+	log.Printf("Syslog encryptor listening on %s (%s)", listener.Addr(), s.kind)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Printf("Error accepting %s connection: %v", s.kind, err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		if !s.track(conn) {
+			RecordRejectedConnection(s.source.Name)
+			log.Printf("Rejecting %s connection from %v: connection limit reached", s.kind, conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+
+		s.wg.Add(1)
+		go s.handleConn(conn)
+	}
+}
+
+// track registers a connection, enforcing the global and per-IP limits
+func (s *StreamSyslogServer) track(conn net.Conn) bool {
+	ip := remoteIP(conn.RemoteAddr())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.MaxConnections > 0 && len(s.conns) >= s.config.MaxConnections {
+		return false
+	}
+	if s.config.MaxConnectionsPer > 0 && s.perIP[ip] >= s.config.MaxConnectionsPer {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.perIP[ip]++
+	AddActiveConnections(s.source.Name, 1)
+	return true
+}
+
+func (s *StreamSyslogServer) untrack(conn net.Conn) {
+	ip := remoteIP(conn.RemoteAddr())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn)
+	if s.perIP[ip]--; s.perIP[ip] <= 0 {
+		delete(s.perIP, ip)
+	}
+	AddActiveConnections(s.source.Name, -1)
+}
+
+func (s *StreamSyslogServer) handleConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	var reader io.Reader = conn
+	if s.config.IdleTimeout > 0 {
+		reader = &idleTimeoutReader{conn: conn, timeout: s.config.IdleTimeout}
+	}
+	parser := NewFramedMessageParser(reader, s.config.Framing, s.config.Delimiter, s.config.MaxFrameSize)
+	parser.SetLimit(s.source.Name, s.source.Limit)
+
+	// Complete the TLS handshake up front so the client identity is known
+	var meta Metadata
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			RecordRejectedConnection(s.source.Name)
+			log.Printf("TLS handshake with %v failed: %v", conn.RemoteAddr(), err)
+			return
+		}
+		tlsConn.SetDeadline(time.Time{})
+		meta = tlsClientMetadata(tlsConn.ConnectionState(), s.allowed)
+	}
+	// Record the peer of network connections, as for UDP senders
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		if meta == nil {
+			meta = make(Metadata, 2)
+		}
+		meta["remote_ip"] = addr.IP.String()
+		meta["remote_port"] = strconv.Itoa(addr.Port)
+	}
+
+	process := func(message []byte, meta Metadata) {
+		if err := s.pipeline.Process(s.source, message, meta); err != nil {
+			log.Printf("Error processing %s message from %v: %v", s.kind, conn.RemoteAddr(), err)
+		}
+	}
+	// Lines of one connection are reassembled together; the last record is emitted on close
+	multiline := NewMultiline(s.source, func(message []byte, meta Metadata, _ time.Time) {
+		process(message, meta)
+	})
+	if multiline != nil {
+		defer multiline.Flush()
+	}
+
+	for {
+		message, err := parser.ReadMessage()
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Closing %s connection from %v: %v", s.kind, conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		// Non-transparent framing may leave a trailing CR (CRLF senders)
+		message = bytes.TrimSuffix(StripTrailingNewline(message), []byte{'\r'})
+		if len(message) == 0 {
+			continue
+		}
+
+		RecordProcessedLog(s.source.Name, len(message))
+		if multiline != nil {
+			multiline.Add(message, meta)
+			continue
+		}
+		process(message, meta)
+	}
+}
+
+// Cleanup closes the listener and all open connections, and removes the Unix socket file
+func (s *StreamSyslogServer) Cleanup() {
+	s.cleanupOnce.Do(func() {
+		s.mu.Lock()
+		if s.listener != nil {
+			log.Printf("Closing %s listener...", s.kind)
+			s.listener.Close()
+		}
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		s.wg.Wait()
+
+		if s.network == "unix" && !s.inherited {
+			log.Printf("Removing socket file: %s", s.addr)
+			if err := os.RemoveAll(s.addr); err != nil {
+				log.Printf("Error removing socket file: %v", err)
+			}
+		}
+	})
+}
+
+// tlsHandshakeTimeout bounds how long a client may take to complete the TLS handshake
+const tlsHandshakeTimeout = 10 * time.Second
+
+// idleTimeoutReader extends the read deadline before every read
+type idleTimeoutReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	if err := r.conn.SetReadDeadline(time.Now().Add(r.timeout)); err != nil {
+		return 0, err
+	}
+	return r.conn.Read(p)
+}
+
+// remoteIP returns the host part of a network address
+func remoteIP(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testRecord is a decrypted output record
+type testRecord struct {
+	Message  string
+	Metadata map[string]string
+}
+
+// waitRecords flushes the router until its output file holds n records, and returns
+// them decrypted. Servers write from their own goroutines, so tests poll.
+func waitRecords(t *testing.T, router *Router, path string, n int) []testRecord {
+	t.Helper()
+	encryptor := testEncryptor(t)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := router.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+		if len(data) > 0 && len(lines) >= n {
+			records := make([]testRecord, len(lines))
+			for i, line := range lines {
+				var entry struct {
+					Attributes map[string]string `json:"a"`
+				}
+				if err := json.Unmarshal(line, &entry); err != nil {
+					t.Fatal(err)
+				}
+				message, err := openRecord(encryptor, line)
+				if err != nil {
+					t.Fatal(err)
+				}
+				records[i] = testRecord{Message: message, Metadata: entry.Attributes}
+			}
+			return records
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d records, want %d", len(lines), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// serveStream runs a stream server on listener until the test ends
+func serveStream(t *testing.T, server *StreamSyslogServer, listener net.Listener) {
+	t.Helper()
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(listener) }()
+	t.Cleanup(func() {
+		server.Cleanup()
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestTCPSyslogServer(t *testing.T) {
+	router, path := testRouter(t)
+	source := &Source{Name: "tcp", SyslogFormat: SyslogFormatAuto}
+	server := NewTCPSyslogServer("", NewPipeline(router, 0, 0), source, StreamConfig{Framing: FramingAuto, Delimiter: '\n', MaxFrameSize: 1024})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveStream(t, server, listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Octet-counted and newline-delimited frames may share a connection; a message
+	// may hold the delimiter only when octet-counted
+	frames := "45 <134>Oct 18 10:00:00 host app: first\nline two" +
+		"<134>Oct 18 10:00:00 host app: second\r\n" +
+		"\n" +
+		"<134>Oct 18 10:00:00 host app: third\n"
+	if _, err := io.WriteString(conn, frames); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	records := waitRecords(t, router, path, 3)
+	want := []string{
+		"<134>Oct 18 10:00:00 host app: first\nline two",
+		"<134>Oct 18 10:00:00 host app: second",
+		"<134>Oct 18 10:00:00 host app: third",
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(records), len(want))
+	}
+	local := conn.LocalAddr().(*net.TCPAddr)
+	for i, record := range records {
+		if record.Message != want[i] {
+			t.Errorf("record %d = %q, want %q", i, record.Message, want[i])
+		}
+		if record.Metadata["remote_ip"] != "127.0.0.1" || record.Metadata["remote_port"] != strconv.Itoa(local.Port) {
+			t.Errorf("record %d metadata = %v, want sender %v", i, record.Metadata, local)
+		}
+	}
+}
+
+func TestStreamConnectionLimit(t *testing.T) {
+	router, path := testRouter(t)
+	source := &Source{Name: "tcp", SyslogFormat: SyslogFormatAuto}
+	server := NewTCPSyslogServer("", NewPipeline(router, 0, 0), source, StreamConfig{Framing: FramingAuto, Delimiter: '\n', MaxFrameSize: 1024, MaxConnectionsPer: 1})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveStream(t, server, listener)
+
+	first, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if _, err := io.WriteString(first, "accepted\n"); err != nil {
+		t.Fatal(err)
+	}
+	waitRecords(t, router, path, 1)
+
+	// A second connection from the same address is closed without being read
+	second, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := second.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read from rejected connection: %v, want EOF", err)
+	}
+
+	// The first connection is still served
+	if _, err := io.WriteString(first, "still accepted\n"); err != nil {
+		t.Fatal(err)
+	}
+	if records := waitRecords(t, router, path, 2); records[1].Message != "still accepted" {
+		t.Errorf("second record = %q", records[1].Message)
+	}
+}
+
+func TestUDPSyslogServer(t *testing.T) {
+	router, path := testRouter(t)
+	// Workers copy each datagram out of the reused read buffer before queueing it
+	pipeline := NewPipeline(router, 4, 8)
+	t.Cleanup(pipeline.Close)
+	source := &Source{Name: "udp", SyslogFormat: SyslogFormatAuto}
+	server := NewUDPSyslogServer("", pipeline, source, 0, 0)
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(conn) }()
+	t.Cleanup(func() {
+		server.Cleanup()
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	})
+
+	client, err := net.DialUDP("udp", nil, conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// Each datagram is one message: a trailing newline is dropped, inner ones are kept
+	want := []string{
+		"<134>Oct 18 10:00:00 switch1 kernel: link up",
+		"<134>Oct 18 10:00:01 switch1 kernel: trace\n  frame 1",
+		"<134>Oct 18 10:00:02 switch1 kernel: x",
+	}
+	for _, message := range want {
+		if _, err := client.Write([]byte(message + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records := waitRecords(t, router, path, len(want))
+	local := client.LocalAddr().(*net.UDPAddr)
+	for i, record := range records {
+		if record.Message != want[i] {
+			t.Errorf("record %d = %q, want %q", i, record.Message, want[i])
+		}
+		if record.Metadata["remote_ip"] != "127.0.0.1" || record.Metadata["remote_port"] != strconv.Itoa(local.Port) {
+			t.Errorf("record %d metadata = %v, want sender %v", i, record.Metadata, local)
+		}
+	}
+}
+
+func TestUnixStreamSyslogServer(t *testing.T) {
+	router, path := testRouter(t)
+	source := &Source{Name: "unix_stream", SyslogFormat: SyslogFormatAuto}
+	socketPath := filepath.Join(t.TempDir(), "syslog.sock")
+	server := NewUnixStreamSyslogServer(socketPath, NewPipeline(router, 0, 0), source, StreamConfig{Framing: FramingAuto, Delimiter: 0, MaxFrameSize: 1024}, SocketPermissions{Mode: 0o620, UID: -1, GID: -1})
+	errs := make(chan error, 1)
+	go func() { errs <- server.Start() }()
+
+	var conns []net.Conn
+	deadline := time.Now().Add(5 * time.Second)
+	for len(conns) < 3 {
+		conn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			if time.Now().After(deadline) {
+				t.Fatal(err)
+			}
+			time.Sleep(5 * time.Millisecond)
+			continue
+		}
+		conns = append(conns, conn)
+	}
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o620 {
+		t.Errorf("socket mode = %04o, want 0620", info.Mode().Perm())
+	}
+
+	// Open connections are served concurrently, each with its own framing
+	want := map[string]bool{}
+	for i := len(conns) - 1; i >= 0; i-- {
+		first := "<134>Oct 18 10:00:00 host app: conn " + strconv.Itoa(i) + " first\nline"
+		second := "conn " + strconv.Itoa(i) + " second"
+		frames := first + "\x00" + strconv.Itoa(len(second)) + " " + second
+		if _, err := io.WriteString(conns[i], frames); err != nil {
+			t.Fatal(err)
+		}
+		want[first], want[second] = true, true
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	for _, record := range waitRecords(t, router, path, len(want)) {
+		if !want[record.Message] {
+			t.Errorf("unexpected record %q", record.Message)
+		}
+		delete(want, record.Message)
+		if len(record.Metadata) != 0 {
+			t.Errorf("record %q has metadata %v", record.Message, record.Metadata)
+		}
+	}
+	for message := range want {
+		t.Errorf("missing record %q", message)
+	}
+
+	// The socket file is removed on shutdown
+	server.Cleanup()
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(socketPath); !os.IsNotExist(err) {
+		t.Errorf("socket file left behind: %v", err)
+	}
+}
+
+// serveUnixgram starts a Unix datagram server on a new socket until the test ends, and
+// returns a client connected to it
+func serveUnixgram(t *testing.T, router *Router, config UnixSocketConfig) *net.UnixConn {
+	t.Helper()
+	source := &Source{Name: "unix", SyslogFormat: SyslogFormatAuto}
+	socketPath := filepath.Join(t.TempDir(), "syslog.sock")
+	server := NewUnixSyslogServer(socketPath, NewPipeline(router, 0, 0), source, config)
+	errs := make(chan error, 1)
+	go func() { errs <- server.Start() }()
+	t.Cleanup(func() {
+		server.Cleanup()
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		client, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socketPath, Net: "unixgram"})
+		if err == nil {
+			t.Cleanup(func() { client.Close() })
+			return client
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
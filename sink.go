@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// OutputSink is a destination for encrypted records. A sink is opened once before the
+// first record and closed at shutdown. Write receives one or more complete JSON lines
+// and is never called concurrently; records are never split across calls. Flush is
+// called when buffered records must reach their destination: on the flush interval
+// and before Close.
+//
+// An error from Open stops the encryptor from starting. An error from Write or Flush
+// loses the records of that call: it is logged and counted, and later records are still
+// written, so a sink should recover (e.g. reconnect) on its next call when it can.
+type OutputSink interface {
+	Open() error
+	Write(records []byte) error
+	Flush() error
+	Close() error
+}
+
+// outputSinkTypes creates sinks by the scheme of an output, e.g. "file:/var/log/audit.json".
+// Further destinations such as network or object storage register here.
+var outputSinkTypes = map[string]func(target string) (OutputSink, error){
+	"stdout": newStdoutSink,
+	"file":   newFileSink,
+}
+
+// parseOutput returns the canonical "scheme:target" name of an output, so every spelling
+// of a destination shares one sink. Empty, "-", "stdout" and "stdout:" select standard
+// output ("stdout:"), "<scheme>:<target>" a registered sink type and any other value a
+// file path.
+func parseOutput(output string) (string, error) {
+	switch output {
+	case "", "-", "stdout":
+		return "stdout:", nil
+	}
+	scheme, target, ok := strings.Cut(output, ":")
+	if _, registered := outputSinkTypes[scheme]; ok && registered {
+		return scheme + ":" + target, nil
+	}
+	if strings.Contains(output, "://") {
+		return "", fmt.Errorf("unknown output type %q", scheme)
+	}
+	return "file:" + output, nil
+}
+
+// NewOutputSink creates the sink of an output without opening it
+func NewOutputSink(output string) (OutputSink, error) {
+	name, err := parseOutput(output)
+	if err != nil {
+		return nil, err
+	}
+	scheme, target, _ := strings.Cut(name, ":")
+	return outputSinkTypes[scheme](target)
+}
+
+// stdoutSink writes records to standard output, which is left open on Close
+type stdoutSink struct{}
+
+func newStdoutSink(target string) (OutputSink, error) {
+	if target != "" {
+		return nil, fmt.Errorf("stdout output takes no target")
+	}
+	return stdoutSink{}, nil
+}
+
+func (stdoutSink) Open() error  { return nil }
+func (stdoutSink) Flush() error { return nil }
+func (stdoutSink) Close() error { return nil }
+
+func (stdoutSink) Write(records []byte) error {
+	_, err := os.Stdout.Write(records)
+	return err
+}
+
+// fileSink appends records to a file. Writes go straight to the file descriptor, so
+// Flush has nothing to do; records are not synced to disk.
+type fileSink struct {
+	path string
+	file *os.File
+}
+
+func newFileSink(path string) (OutputSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file output requires a path")
+	}
+	return &fileSink{path: path}, nil
+}
+
+func (s *fileSink) Open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	return nil
+}
+
+func (s *fileSink) Write(records []byte) error {
+	_, err := s.file.Write(records)
+	return err
+}
+
+func (s *fileSink) Flush() error { return nil }
+
+func (s *fileSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseOutput(t *testing.T) {
+	tests := []struct {
+		output  string
+		want    string
+		wantErr bool
+	}{
+		// Every spelling of standard output is one destination
+		{output: "", want: "stdout:"},
+		{output: "-", want: "stdout:"},
+		{output: "stdout", want: "stdout:"},
+		{output: "stdout:", want: "stdout:"},
+		{output: "stdout:extra", want: "stdout:extra"}, // Rejected by the stdout sink
+
+		{output: "file:/var/log/audit.json", want: "file:/var/log/audit.json"},
+		{output: "file:relative.json", want: "file:relative.json"},
+		{output: "file:", want: "file:"}, // Rejected by the file sink
+
+		// Anything else is a file path, including names with a colon
+		{output: "/var/log/audit.json", want: "file:/var/log/audit.json"},
+		{output: "audit.json", want: "file:audit.json"},
+		{output: "audit:2024.json", want: "file:audit:2024.json"},
+		{output: `C:\logs\audit.json`, want: `file:C:\logs\audit.json`},
+
+		// URLs of unregistered sink types are mistakes, not file names
+		{output: "s3://bucket/audit", wantErr: true},
+		{output: "tcp://collector:514", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseOutput(tt.output)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseOutput(%q) = %q, want error", tt.output, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseOutput(%q) = %q, %v, want %q", tt.output, got, err, tt.want)
+		}
+	}
+}
+
+func TestNewOutputSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	tests := []struct {
+		output  string
+		wantErr bool
+	}{
+		{output: "-"},
+		{output: "stdout:"},
+		{output: path},
+		{output: "file:" + path},
+		{output: "stdout:extra", wantErr: true},
+		{output: "file:", wantErr: true},
+		{output: "s3://bucket/audit", wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := NewOutputSink(tt.output)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewOutputSink(%q) error = %v, want error %v", tt.output, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRouterSharesOutputs(t *testing.T) {
+	encryptor := testEncryptor(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.json")
+	publicKey := hex.EncodeToString(encryptor.publicKey[:])
+	routes := []RouteConfig{
+		{Tag: "a", PublicKey: publicKey, Output: "-"},
+		{Tag: "b", PublicKey: publicKey, Output: "stdout:"},
+		{Tag: "c", PublicKey: publicKey, Output: path},
+		{Tag: "d", PublicKey: publicKey, Output: "file:" + path},
+	}
+	router, err := NewRouter(encryptor.privateKey, encryptor, routes, nil, nil, nil, OutputConfig{Default: "stdout"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Close()
+
+	// One stdout sink and one file sink, however the routes spell them
+	if len(router.outputs) != 2 {
+		t.Errorf("router opened %d outputs, want 2", len(router.outputs))
+	}
+	if router.routes[0].output != router.defaultRoute.output || router.routes[1].output != router.defaultRoute.output {
+		t.Error("stdout routes do not share the default output")
+	}
+	if router.routes[2].output != router.routes[3].output {
+		t.Error("file routes to the same path do not share an output")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("file output not opened: %v", err)
+	}
+}
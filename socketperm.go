@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// SocketPermissions controls who may write to a Unix socket file
+type SocketPermissions struct {
+	Mode os.FileMode
+	UID  int // -1 leaves the owner unchanged
+	GID  int // -1 leaves the group unchanged
+}
+
+// ParseSocketPermissions parses an octal mode (e.g. "0660") and an owner and group
+// given as names or numeric IDs. Empty values keep the defaults.
+func ParseSocketPermissions(mode, owner, group string, defaultMode os.FileMode) (SocketPermissions, error) {
+	perms := SocketPermissions{Mode: defaultMode, UID: -1, GID: -1}
+
+	if mode != "" {
+		m, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || m > 0777 {
+			return perms, fmt.Errorf("invalid socket mode %q (expected octal, e.g. 0660)", mode)
+		}
+		perms.Mode = os.FileMode(m)
+	}
+
+	if owner != "" {
+		uid, err := lookupUID(owner)
+		if err != nil {
+			return perms, err
+		}
+		perms.UID = int(uid)
+	}
+
+	if group != "" {
+		gid, err := strconv.ParseUint(group, 10, 32)
+		if err != nil {
+			g, lookupErr := user.LookupGroup(group)
+			if lookupErr != nil {
+				return perms, fmt.Errorf("unknown socket group %q: %w", group, lookupErr)
+			}
+			gid, _ = strconv.ParseUint(g.Gid, 10, 32)
+		}
+		perms.GID = int(gid)
+	}
+
+	return perms, nil
+}
+
+// Apply sets the mode and ownership of a socket file
+func (p SocketPermissions) Apply(path string) error {
+	if p.UID >= 0 || p.GID >= 0 {
+		if err := os.Chown(path, p.UID, p.GID); err != nil {
+			return fmt.Errorf("failed to set socket ownership: %w", err)
+		}
+	}
+	if err := os.Chmod(path, p.Mode); err != nil {
+		return fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return nil
+}
+
+// ParseUIDList parses a comma-separated list of user names or numeric UIDs
+func ParseUIDList(value string) (map[uint32]bool, error) {
+	items := splitList(value)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	uids := make(map[uint32]bool, len(items))
+	for _, item := range items {
+		uid, err := lookupUID(item)
+		if err != nil {
+			return nil, err
+		}
+		uids[uid] = true
+	}
+	return uids, nil
+}
+
+// lookupUID resolves a user name or numeric UID
+func lookupUID(name string) (uint32, error) {
+	if uid, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(uid), nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, fmt.Errorf("unknown user %q: %w", name, err)
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("user %q has non-numeric uid %q", name, u.Uid)
+	}
+	return uint32(uid), nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSocketPermissions(t *testing.T) {
+	tests := []struct {
+		mode, owner, group string
+		want               SocketPermissions
+		wantErr            bool
+	}{
+		{want: SocketPermissions{Mode: 0o666, UID: -1, GID: -1}},
+		{mode: "0660", want: SocketPermissions{Mode: 0o660, UID: -1, GID: -1}},
+		{mode: "620", owner: "0", group: "0", want: SocketPermissions{Mode: 0o620, UID: 0, GID: 0}},
+		{owner: "root", group: "1000", want: SocketPermissions{Mode: 0o666, UID: 0, GID: 1000}},
+		{mode: "0999", wantErr: true},
+		{mode: "1777", wantErr: true},
+		{mode: "rw-rw----", wantErr: true},
+		{owner: "no-such-user-for-tests", wantErr: true},
+		{group: "no-such-group-for-tests", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSocketPermissions(tt.mode, tt.owner, tt.group, 0o666)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSocketPermissions(%q, %q, %q) = %+v, want error", tt.mode, tt.owner, tt.group, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseSocketPermissions(%q, %q, %q) = %+v, %v, want %+v", tt.mode, tt.owner, tt.group, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseUIDList(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    map[uint32]bool
+		wantErr bool
+	}{
+		{value: "", want: nil},
+		{value: " , ", want: nil},
+		{value: "0, 1000,root", want: map[uint32]bool{0: true, 1000: true}},
+		{value: "1000,no-such-user-for-tests", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseUIDList(tt.value)
+		if (err != nil) != tt.wantErr || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseUIDList(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestSocketPermissionsApply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "syslog.sock")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	perms := SocketPermissions{Mode: 0o620, UID: os.Getuid(), GID: -1}
+	if err := perms.Apply(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o620 {
+		t.Errorf("mode = %04o, want 0620", info.Mode().Perm())
+	}
+
+	if err := perms.Apply(filepath.Join(t.TempDir(), "missing.sock")); err == nil {
+		t.Error("Apply succeeded on a missing socket file")
+	}
+}
+
+func TestUnixSyslogServerAllowedUIDs(t *testing.T) {
+	server := &UnixSyslogServer{source: &Source{Name: "unix"}}
+	if !server.allowed(nil, false) {
+		t.Error("datagram without credentials rejected without an allow-list")
+	}
+	server.config.AllowedUIDs = map[uint32]bool{0: true, 1000: true}
+	tests := []struct {
+		creds *Credentials
+		ok    bool
+		want  bool
+	}{
+		{&Credentials{UID: 1000}, true, true},
+		{&Credentials{UID: 0}, true, true},
+		{&Credentials{UID: 1001}, true, false},
+		{nil, false, false},
+	}
+	for _, tt := range tests {
+		if got := server.allowed(tt.creds, tt.ok); got != tt.want {
+			t.Errorf("allowed(%+v, %v) = %v, want %v", tt.creds, tt.ok, got, tt.want)
+		}
+	}
+
+	if !credentialsSupported {
+		t.Skip("sender credentials are only available on Linux")
+	}
+	// Only the allowed sender's datagram is written
+	router, path := testRouter(t)
+	config := UnixSocketConfig{
+		Permissions: SocketPermissions{Mode: 0o666, UID: -1, GID: -1},
+		Credentials: true,
+		AllowedUIDs: map[uint32]bool{uint32(os.Getuid()): true},
+	}
+	client := serveUnixgram(t, router, config)
+	if _, err := client.Write([]byte("from an allowed sender")); err != nil {
+		t.Fatal(err)
+	}
+	rejectedRouter, rejectedPath := testRouter(t)
+	config.AllowedUIDs = map[uint32]bool{uint32(os.Getuid()) + 1: true}
+	rejected := serveUnixgram(t, rejectedRouter, config)
+	if _, err := rejected.Write([]byte("from another sender")); err != nil {
+		t.Fatal(err)
+	}
+
+	if records := waitRecords(t, router, path, 1); records[0].Message != "from an allowed sender" {
+		t.Errorf("record = %q", records[0].Message)
+	}
+	if data, err := os.ReadFile(rejectedPath); err != nil || len(data) != 0 {
+		t.Errorf("rejected sender wrote %q, %v", data, err)
+	}
+}
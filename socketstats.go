@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"syscall"
+	"time"
+)
+
+// datagramConn is a Unix or UDP datagram socket
+type datagramConn interface {
+	syscall.Conn
+	SetReadBuffer(bytes int) error
+}
+
+// SocketStats is a reading of a datagram socket's kernel receive queue
+type SocketStats struct {
+	QueuedBytes int    // Bytes waiting in the receive queue
+	BufferBytes int    // Effective receive buffer size
+	Drops       uint32 // Datagrams the kernel dropped for this socket (wraps around)
+}
+
+// configureReadBuffer applies a requested receive buffer size (0 keeps the kernel default)
+func configureReadBuffer(listener string, conn datagramConn, size int) error {
+	if size <= 0 {
+		return nil
+	}
+	effective, err := setReadBuffer(conn, size)
+	if err != nil {
+		return err
+	}
+	if granted, capped := readBufferCapped(effective, size); capped {
+		log.Printf("Warning: %s receive buffer is %d bytes, less than the requested %d (raise net.core.rmem_max or grant CAP_NET_ADMIN)", listener, granted, size)
+	}
+	return nil
+}
+
+// readBufferCapped converts the receive buffer size reported by the kernel into the size
+// it granted, and reports whether that is less than the requested size
+func readBufferCapped(effective, size int) (int, bool) {
+	granted := effective / rcvbufScale
+	return granted, granted < size
+}
+
+// monitorSocketStats exports the socket's receive queue usage and kernel drop counter
+// every interval until the socket is closed
+func monitorSocketStats(listener string, conn datagramConn, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	stats, err := readSocketStats(conn)
+	if err != nil {
+		log.Printf("Socket statistics unavailable for %s: %v", listener, err)
+		return
+	}
+	lastDrops := stats.Drops
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		SetSocketQueue(listener, stats.QueuedBytes, stats.BufferBytes)
+		<-ticker.C
+		if stats, err = readSocketStats(conn); err != nil {
+			return // Socket closed
+		}
+		if drops := stats.Drops - lastDrops; drops > 0 {
+			RecordSocketDrops(listener, int(drops))
+			log.Printf("Warning: kernel dropped %d datagrams on %s (receive queue %d of %d bytes)", drops, listener, stats.QueuedBytes, stats.BufferBytes)
+		}
+		lastDrops = stats.Drops
+	}
+}
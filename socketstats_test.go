@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestReadBufferCapped(t *testing.T) {
+	const rmemMax = 212992 // A common net.core.rmem_max
+	tests := []struct {
+		effective, size int
+		capped          bool
+	}{
+		{rcvbufScale * 4194304, 4194304, false},
+		{rcvbufScale * 4194304, 1048576, false},
+		// Capped by rmem_max: the reported size can exceed the request and still be short of it
+		{rcvbufScale * rmemMax, 300000, true},
+		{rcvbufScale * rmemMax, 4194304, true},
+		{rcvbufScale * rmemMax, rmemMax, false},
+	}
+	for _, tt := range tests {
+		if granted, capped := readBufferCapped(tt.effective, tt.size); capped != tt.capped || granted != tt.effective/rcvbufScale {
+			t.Errorf("readBufferCapped(%d, %d) = %d, %v, want capped %v", tt.effective, tt.size, granted, capped, tt.capped)
+		}
+	}
+}
+
+func TestSetReadBuffer(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("UDP socket unavailable: %v", err)
+	}
+	defer conn.Close()
+
+	// A size below every default rmem_max is granted in full, reported rcvbufScale times
+	const size = 65536
+	effective, err := setReadBuffer(conn, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if granted, capped := readBufferCapped(effective, size); capped || granted != size {
+		t.Errorf("setReadBuffer(%d) reported %d, granted %d, capped %v", size, effective, granted, capped)
+	}
+}
@@ -0,0 +1,80 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// soMeminfo is SO_MEMINFO from asm-generic/socket.h (missing from package syscall)
+const soMeminfo = 55
+
+// Indexes into the SO_MEMINFO array (linux/sock_diag.h)
+const (
+	skMeminfoRmemAlloc = 0
+	skMeminfoRcvbuf    = 1
+	skMeminfoDrops     = 8
+	skMeminfoVars      = 9
+)
+
+// rcvbufScale is the factor between the requested and the reported SO_RCVBUF: Linux
+// doubles the requested size to account for bookkeeping overhead
+const rcvbufScale = 2
+
+// setReadBuffer sets the kernel receive buffer, using SO_RCVBUFFORCE to exceed
+// net.core.rmem_max when the process has CAP_NET_ADMIN. Returns the effective size
+// as the kernel reports it, rcvbufScale times the size it granted.
+func setReadBuffer(conn datagramConn, size int) (int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var effective int
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUFFORCE, size)
+		if errors.Is(sockErr, syscall.EPERM) {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, size)
+		}
+		if sockErr == nil {
+			effective, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+		}
+	}); err != nil {
+		return 0, err
+	}
+	if sockErr != nil {
+		return 0, fmt.Errorf("setsockopt SO_RCVBUF: %w", sockErr)
+	}
+	return effective, nil
+}
+
+// readSocketStats reads the receive queue usage and drop counter via SO_MEMINFO
+func readSocketStats(conn datagramConn) (SocketStats, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return SocketStats{}, err
+	}
+	var meminfo [skMeminfoVars]uint32
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		size := uint32(unsafe.Sizeof(meminfo))
+		_, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.SOL_SOCKET, soMeminfo,
+			uintptr(unsafe.Pointer(&meminfo[0])), uintptr(unsafe.Pointer(&size)), 0)
+		if errno != 0 {
+			sockErr = errno
+		}
+	}); err != nil {
+		return SocketStats{}, err
+	}
+	if sockErr != nil {
+		return SocketStats{}, fmt.Errorf("getsockopt SO_MEMINFO: %w", sockErr)
+	}
+	return SocketStats{
+		QueuedBytes: int(meminfo[skMeminfoRmemAlloc]),
+		BufferBytes: int(meminfo[skMeminfoRcvbuf]),
+		Drops:       meminfo[skMeminfoDrops],
+	}, nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+// rcvbufScale is the factor between the requested and the reported SO_RCVBUF
+const rcvbufScale = 1
+
+// setReadBuffer sets SO_RCVBUF; SO_RCVBUFFORCE is Linux only
+func setReadBuffer(conn datagramConn, size int) (int, error) {
+	if err := conn.SetReadBuffer(size); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// readSocketStats is only implemented on Linux (SO_MEMINFO)
+func readSocketStats(conn datagramConn) (SocketStats, error) {
+	return SocketStats{}, fmt.Errorf("SO_MEMINFO is only supported on Linux")
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Syslog facility names as used by rsyslog/syslog-ng configuration, indexed by code
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "clock",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// Syslog severity names (RFC 5424 section 6.2.1)
+var severityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// ParseFacility converts a facility name (e.g. "local0") or number into its numeric code
+func ParseFacility(name string) (int, bool) {
+	for code, n := range facilityNames {
+		if strings.EqualFold(n, name) {
+			return code, true
+		}
+	}
+	code, err := strconv.Atoi(name)
+	if err != nil || code < 0 || code >= len(facilityNames) {
+		return 0, false
+	}
+	return code, true
+}
+
+// FacilityName returns the configuration name of a facility code
+func FacilityName(code int) string {
+	if code >= 0 && code < len(facilityNames) {
+		return facilityNames[code]
+	}
+	return strconv.Itoa(code)
+}
+
+// ParseSeverity converts a severity name (e.g. "err", "warning") or number into its numeric code
+func ParseSeverity(name string) (int, bool) {
+	switch strings.ToLower(name) {
+	case "panic":
+		return 0, true
+	case "error":
+		return 3, true
+	case "warn":
+		return 4, true
+	}
+	for code, n := range severityNames {
+		if strings.EqualFold(n, name) {
+			return code, true
+		}
+	}
+	code, err := strconv.Atoi(name)
+	if err != nil || code < 0 || code > 7 {
+		return 0, false
+	}
+	return code, true
+}
+
+// SyslogFormat selects how a listener parses incoming messages
+type SyslogFormat int
+
+const (
+	// SyslogFormatNone treats messages as opaque strings
+	SyslogFormatNone SyslogFormat = iota
+	// SyslogFormatAuto detects RFC 5424 by its version field, otherwise parses RFC 3164
+	SyslogFormatAuto
+	// SyslogFormatRFC3164 parses BSD syslog messages
+	SyslogFormatRFC3164
+	// SyslogFormatRFC5424 parses IETF syslog messages
+	SyslogFormatRFC5424
+	// SyslogFormatJournal reads the header fields of JSON journal entries
+	SyslogFormatJournal
+)
+
+// ParseSyslogFormat converts a format name ("none", "auto", "rfc3164", "rfc5424", "journal") to a SyslogFormat
+func ParseSyslogFormat(name string) (SyslogFormat, error) {
+	switch strings.ToLower(name) {
+	case "none", "raw":
+		return SyslogFormatNone, nil
+	case "auto":
+		return SyslogFormatAuto, nil
+	case "rfc3164", "bsd":
+		return SyslogFormatRFC3164, nil
+	case "rfc5424", "ietf":
+		return SyslogFormatRFC5424, nil
+	case "journal":
+		return SyslogFormatJournal, nil
+	}
+	return 0, fmt.Errorf("unknown syslog format %q (expected none, auto, rfc3164, rfc5424 or journal)", name)
+}
+
+// String returns the configuration name of a syslog format
+func (f SyslogFormat) String() string {
+	switch f {
+	case SyslogFormatAuto:
+		return "auto"
+	case SyslogFormatRFC3164:
+		return "rfc3164"
+	case SyslogFormatRFC5424:
+		return "rfc5424"
+	case SyslogFormatJournal:
+		return "journal"
+	}
+	return "none"
+}
+
+// SDElement is an RFC 5424 structured data element
+type SDElement struct {
+	ID     string
+	Params map[string]string
+}
+
+// SyslogMessage holds the fields parsed from an RFC 3164 or RFC 5424 message
+type SyslogMessage struct {
+	Format         SyslogFormat
+	Facility       int
+	Severity       int
+	Timestamp      time.Time // Zero when the message carries no timestamp
+	Hostname       string
+	AppName        string // RFC 5424 APP-NAME or RFC 3164 TAG
+	ProcID         string
+	MsgID          string
+	StructuredData []SDElement
+	Message        []byte
+}
+
+// ParseSyslog parses a raw syslog message. The returned message references data.
+func ParseSyslog(data []byte, format SyslogFormat) (*SyslogMessage, error) {
+	if format == SyslogFormatJournal {
+		return parseJournal(data)
+	}
+	facility, severity, rest, ok := parsePriority(data)
+	if !ok {
+		return nil, fmt.Errorf("missing or invalid PRI")
+	}
+	msg := &SyslogMessage{Facility: facility, Severity: severity}
+
+	isRFC5424 := len(rest) > 1 && rest[0] == '1' && rest[1] == ' '
+	switch {
+	case format == SyslogFormatRFC5424 || (format == SyslogFormatAuto && isRFC5424):
+		msg.Format = SyslogFormatRFC5424
+		if err := parseRFC5424(msg, rest); err != nil {
+			return nil, err
+		}
+	case format == SyslogFormatRFC3164 || format == SyslogFormatAuto:
+		msg.Format = SyslogFormatRFC3164
+		parseRFC3164(msg, rest, time.Now())
+	default:
+		return nil, fmt.Errorf("syslog parsing disabled")
+	}
+	return msg, nil
+}
+
+// parsePriority extracts the facility and severity from a leading "<PRI>" field.
+// Returns the remaining bytes after the PRI field and false if no valid PRI is present.
+func parsePriority(data []byte) (facility, severity int, rest []byte, ok bool) {
+	if len(data) < 3 || data[0] != '<' {
+		return 0, 0, data, false
+	}
+	end := bytes.IndexByte(data[:min(len(data), 5)], '>')
+	if end < 2 {
+		return 0, 0, data, false
+	}
+	pri, err := strconv.Atoi(string(data[1:end]))
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, 0, data, false
+	}
+	return pri / 8, pri % 8, data[end+1:], true
+}
+
+// parseRFC5424 parses "VERSION SP TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP SD [SP MSG]"
+func parseRFC5424(msg *SyslogMessage, data []byte) error {
+	if len(data) < 2 || data[0] != '1' || data[1] != ' ' {
+		return fmt.Errorf("unsupported RFC 5424 version")
+	}
+	rest := data[2:]
+
+	var fields [5]string
+	for i := range fields {
+		sp := bytes.IndexByte(rest, ' ')
+		if sp <= 0 {
+			return fmt.Errorf("truncated RFC 5424 header")
+		}
+		fields[i] = string(rest[:sp])
+		rest = rest[sp+1:]
+	}
+
+	if fields[0] != "-" {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid RFC 5424 timestamp: %w", err)
+		}
+		msg.Timestamp = ts
+	}
+	msg.Hostname = nilValue(fields[1])
+	msg.AppName = nilValue(fields[2])
+	msg.ProcID = nilValue(fields[3])
+	msg.MsgID = nilValue(fields[4])
+
+	sd, rest, err := parseStructuredData(rest)
+	if err != nil {
+		return err
+	}
+	msg.StructuredData = sd
+
+	if len(rest) > 0 && rest[0] == ' ' {
+		rest = rest[1:]
+	}
+	msg.Message = bytes.TrimPrefix(rest, []byte("\xef\xbb\xbf"))
+	return nil
+}
+
+// nilValue maps the RFC 5424 NILVALUE "-" to an empty string
+func nilValue(field string) string {
+	if field == "-" {
+		return ""
+	}
+	return field
+}
+
+// parseStructuredData parses "-" or one or more "[SD-ID PARAM="VALUE" ...]" elements
+func parseStructuredData(data []byte) ([]SDElement, []byte, error) {
+	if len(data) > 0 && data[0] == '-' {
+		return nil, data[1:], nil
+	}
+
+	var elements []SDElement
+	for len(data) > 0 && data[0] == '[' {
+		data = data[1:]
+		end := bytes.IndexAny(data, " ]")
+		if end <= 0 {
+			return nil, nil, fmt.Errorf("invalid structured data element")
+		}
+		element := SDElement{ID: string(data[:end]), Params: make(map[string]string)}
+		data = data[end:]
+
+		for len(data) > 0 && data[0] == ' ' {
+			data = data[1:]
+			eq := bytes.Index(data, []byte(`="`))
+			if eq <= 0 || bytes.IndexAny(data[:eq], ` ="]`) >= 0 {
+				return nil, nil, fmt.Errorf("invalid structured data parameter")
+			}
+			name := string(data[:eq])
+			data = data[eq+2:]
+
+			// PARAM-VALUE escapes '"', '\' and ']' with a backslash
+			var value []byte
+			closed := false
+			for i := 0; i < len(data); i++ {
+				if data[i] == '\\' && i+1 < len(data) && bytes.IndexByte([]byte(`"\]`), data[i+1]) >= 0 {
+					value = append(value, data[i+1])
+					i++
+					continue
+				}
+				if data[i] == '"' {
+					data = data[i+1:]
+					closed = true
+					break
+				}
+				value = append(value, data[i])
+			}
+			if !closed {
+				return nil, nil, fmt.Errorf("unterminated structured data value")
+			}
+			element.Params[name] = string(value)
+		}
+
+		if len(data) == 0 || data[0] != ']' {
+			return nil, nil, fmt.Errorf("unterminated structured data element")
+		}
+		data = data[1:]
+		elements = append(elements, element)
+	}
+
+	if elements == nil {
+		return nil, nil, fmt.Errorf("missing structured data")
+	}
+	return elements, data, nil
+}
+
+// parseRFC3164 parses "TIMESTAMP SP [HOSTNAME SP] TAG[PID]: MSG". Every part after PRI
+// is optional, so this never fails; unrecognized content is kept as the message.
+func parseRFC3164(msg *SyslogMessage, data []byte, now time.Time) {
+	rest := data
+	stamped := false // A timestamp was read, even one without a valid date
+
+	// "Mmm dd hh:mm:ss" (day space-padded) as sent by syslog(3)
+	if len(rest) >= 16 && rest[15] == ' ' {
+		if stamp, err := time.ParseInLocation(time.Stamp, string(rest[:15]), time.Local); err == nil {
+			// RFC 3164 timestamps have no year: pick the year that keeps the time closest to now.
+			// time.Date moves Feb 29 of other years to Mar 1, so such a year is skipped, and a
+			// Feb 29 that fits neither year leaves the timestamp unset.
+			withYear := func(year int) (time.Time, bool) {
+				ts := time.Date(year, stamp.Month(), stamp.Day(), stamp.Hour(), stamp.Minute(), stamp.Second(), 0, time.Local)
+				return ts, ts.Month() == stamp.Month() && ts.Day() == stamp.Day()
+			}
+			ts, ok := withYear(now.Year())
+			if !ok || ts.After(now.Add(24*time.Hour)) {
+				ts, ok = withYear(now.Year() - 1)
+			}
+			if ok {
+				msg.Timestamp = ts
+			}
+			stamped = true
+			rest = rest[16:]
+		}
+	}
+	// RFC 3339 timestamps as sent by rsyslog's high-precision templates
+	if !stamped {
+		if sp := bytes.IndexByte(rest, ' '); sp > 0 {
+			if ts, err := time.Parse(time.RFC3339Nano, string(rest[:sp])); err == nil {
+				msg.Timestamp = ts
+				stamped = true
+				rest = rest[sp+1:]
+			}
+		}
+	}
+
+	// Local clients writing to /dev/log usually omit the hostname, so the first
+	// token is only a hostname when it does not look like a tag
+	if stamped {
+		if sp := bytes.IndexByte(rest, ' '); sp > 0 {
+			if _, _, ok := splitTag(rest[:sp]); !ok {
+				msg.Hostname = string(rest[:sp])
+				rest = rest[sp+1:]
+			}
+		}
+	}
+
+	if sp := bytes.IndexByte(rest, ' '); sp > 0 {
+		if tag, pid, ok := splitTag(rest[:sp]); ok {
+			msg.AppName = tag
+			msg.ProcID = pid
+			rest = rest[sp+1:]
+		}
+	}
+	msg.Message = rest
+}
+
+// splitTag splits a "tag[pid]:", "tag[pid]" or "tag:" token
+func splitTag(token []byte) (tag, pid string, ok bool) {
+	colon := bytes.HasSuffix(token, []byte{':'})
+	token = bytes.TrimSuffix(token, []byte{':'})
+	if i := bytes.IndexByte(token, '['); i > 0 && token[len(token)-1] == ']' {
+		return string(token[:i]), string(token[i+1 : len(token)-1]), true
+	}
+	if colon && len(token) > 0 && bytes.IndexAny(token, "[]") < 0 {
+		return string(token), "", true
+	}
+	return "", "", false
+}
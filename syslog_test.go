@@ -0,0 +1,225 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSyslog(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		format    SyslogFormat
+		wantErr   bool
+		want      SyslogMessage // Timestamp is compared separately
+		timestamp string        // RFC3339Nano, "any" for a syslog(3) timestamp, empty for none
+	}{
+		{
+			name:   "rfc5424 with structured data and BOM",
+			data:   "<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut=\"3\" eventSource=\"Application\"] \xef\xbb\xbfAn application event",
+			format: SyslogFormatAuto,
+			want: SyslogMessage{
+				Format: SyslogFormatRFC5424, Facility: 20, Severity: 5, Hostname: "mymachine.example.com", AppName: "evntslog", MsgID: "ID47",
+				StructuredData: []SDElement{{ID: "exampleSDID@32473", Params: map[string]string{"iut": "3", "eventSource": "Application"}}},
+				Message:        []byte("An application event"),
+			},
+			timestamp: "2003-10-11T22:14:15.003Z",
+		},
+		{
+			name:   "rfc5424 with nil values",
+			data:   "<34>1 - - - - - -",
+			format: SyslogFormatRFC5424,
+			want:   SyslogMessage{Format: SyslogFormatRFC5424, Facility: 4, Severity: 2, Message: []byte{}},
+		},
+		{
+			name:      "rfc5424 with offset",
+			data:      "<13>1 2024-05-02T12:00:00.5+02:00 host app 42 - - hello",
+			format:    SyslogFormatAuto,
+			want:      SyslogMessage{Format: SyslogFormatRFC5424, Facility: 1, Severity: 5, Hostname: "host", AppName: "app", ProcID: "42", Message: []byte("hello")},
+			timestamp: "2024-05-02T12:00:00.5+02:00",
+		},
+		{name: "rfc5424 without structured data", data: "<13>1 - host app 42 -", format: SyslogFormatRFC5424, wantErr: true},
+		{name: "rfc5424 invalid timestamp", data: "<13>1 yesterday host app - - - x", format: SyslogFormatAuto, wantErr: true},
+		{name: "rfc5424 forced on rfc3164", data: "<13>Oct 18 10:00:00 host app: x", format: SyslogFormatRFC5424, wantErr: true},
+		{
+			name:      "rfc3164 with hostname and pid",
+			data:      "<86>Oct 18 10:00:00 host sshd[4242]: Accepted publickey",
+			format:    SyslogFormatAuto,
+			want:      SyslogMessage{Format: SyslogFormatRFC3164, Facility: 10, Severity: 6, Hostname: "host", AppName: "sshd", ProcID: "4242", Message: []byte("Accepted publickey")},
+			timestamp: "any",
+		},
+		{
+			name:      "rfc3164 from /dev/log without hostname",
+			data:      "<13>Oct  1 10:00:00 app: hello world",
+			format:    SyslogFormatRFC3164,
+			want:      SyslogMessage{Format: SyslogFormatRFC3164, Facility: 1, Severity: 5, AppName: "app", Message: []byte("hello world")},
+			timestamp: "any",
+		},
+		{
+			name:      "rfc3164 with rfc3339 timestamp",
+			data:      "<14>2024-05-02T10:00:00.123456Z web01 nginx: GET /",
+			format:    SyslogFormatAuto,
+			want:      SyslogMessage{Format: SyslogFormatRFC3164, Facility: 1, Severity: 6, Hostname: "web01", AppName: "nginx", Message: []byte("GET /")},
+			timestamp: "2024-05-02T10:00:00.123456Z",
+		},
+		{
+			name:   "rfc3164 with only a tag",
+			data:   "<13>app[7]: no timestamp",
+			format: SyslogFormatAuto,
+			want:   SyslogMessage{Format: SyslogFormatRFC3164, Facility: 1, Severity: 5, AppName: "app", ProcID: "7", Message: []byte("no timestamp")},
+		},
+		{
+			name:   "rfc3164 without header",
+			data:   "<13>just text",
+			format: SyslogFormatAuto,
+			want:   SyslogMessage{Format: SyslogFormatRFC3164, Facility: 1, Severity: 5, Message: []byte("just text")},
+		},
+		{
+			name:   "highest priority",
+			data:   "<191>x",
+			format: SyslogFormatAuto,
+			want:   SyslogMessage{Format: SyslogFormatRFC3164, Facility: 23, Severity: 7, Message: []byte("x")},
+		},
+		{name: "priority out of range", data: "<192>x", format: SyslogFormatAuto, wantErr: true},
+		{name: "priority too long", data: "<1234>x", format: SyslogFormatAuto, wantErr: true},
+		{name: "empty priority", data: "<>x", format: SyslogFormatAuto, wantErr: true},
+		{name: "no priority", data: "Oct 18 10:00:00 host app: x", format: SyslogFormatAuto, wantErr: true},
+		{name: "parsing disabled", data: "<13>x", format: SyslogFormatNone, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := ParseSyslog([]byte(tt.data), tt.format)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseSyslog(%q) = %+v, want error", tt.data, msg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSyslog(%q): %v", tt.data, err)
+			}
+
+			timestamp := msg.Timestamp
+			got := *msg
+			got.Timestamp = time.Time{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSyslog(%q)\n got %+v\nwant %+v", tt.data, got, tt.want)
+			}
+			switch tt.timestamp {
+			case "":
+				if !timestamp.IsZero() {
+					t.Errorf("timestamp = %v, want none", timestamp)
+				}
+			case "any":
+				if timestamp.IsZero() {
+					t.Error("timestamp missing")
+				}
+			default:
+				if got := timestamp.Format(time.RFC3339Nano); got != tt.timestamp {
+					t.Errorf("timestamp = %s, want %s", got, tt.timestamp)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRFC3164Timestamp(t *testing.T) {
+	newYear := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	tests := []struct {
+		now  time.Time
+		data string
+		want time.Time
+		rest string
+	}{
+		{newYear, "Jan  1 09:59:00 host app: x", time.Date(2024, 1, 1, 9, 59, 0, 0, time.Local), "x"},
+		// A timestamp up to a day ahead is clock skew, later ones are from last year
+		{newYear, "Jan  2 09:00:00 host app: x", time.Date(2024, 1, 2, 9, 0, 0, 0, time.Local), "x"},
+		{newYear, "Dec 31 23:59:59 host app: x", time.Date(2023, 12, 31, 23, 59, 59, 0, time.Local), "x"},
+		{newYear, "Oct 18 10:00:00 app: x", time.Date(2023, 10, 18, 10, 0, 0, 0, time.Local), "x"},
+		{time.Date(2025, 1, 1, 10, 0, 0, 0, time.Local), "Feb 29 12:00:00 host app: x", time.Date(2024, 2, 29, 12, 0, 0, 0, time.Local), "x"},
+		{time.Date(2024, 3, 1, 10, 0, 0, 0, time.Local), "Feb 29 12:00:00 host app: x", time.Date(2024, 2, 29, 12, 0, 0, 0, time.Local), "x"},
+		// Feb 29 is never moved to Mar 1 of a year without it
+		{time.Date(2025, 3, 1, 10, 0, 0, 0, time.Local), "Feb 29 12:00:00 host app: x", time.Date(2024, 2, 29, 12, 0, 0, 0, time.Local), "x"},
+		{time.Date(2025, 12, 31, 10, 0, 0, 0, time.Local), "Feb 29 12:00:00 host app: x", time.Date(2024, 2, 29, 12, 0, 0, 0, time.Local), "x"},
+		{time.Date(2028, 2, 29, 13, 0, 0, 0, time.Local), "Feb 29 12:00:00 host app: x", time.Date(2028, 2, 29, 12, 0, 0, 0, time.Local), "x"},
+		{time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local), "Feb 29 12:00:00 host app: x", time.Time{}, "x"},
+		{time.Date(2027, 1, 15, 10, 0, 0, 0, time.Local), "Feb 29 12:00:00 host app: x", time.Time{}, "x"},
+		{newYear, "Xyz 18 10:00:00 host app: x", time.Time{}, "Xyz 18 10:00:00 host app: x"},
+	}
+	for _, tt := range tests {
+		var msg SyslogMessage
+		parseRFC3164(&msg, []byte(tt.data), tt.now)
+		if !msg.Timestamp.Equal(tt.want) {
+			t.Errorf("parseRFC3164(%q) timestamp = %v, want %v", tt.data, msg.Timestamp, tt.want)
+		}
+		if string(msg.Message) != tt.rest {
+			t.Errorf("parseRFC3164(%q) message = %q, want %q", tt.data, msg.Message, tt.rest)
+		}
+	}
+}
+
+func TestParseStructuredData(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    []SDElement
+		rest    string
+		wantErr bool
+	}{
+		{data: "- msg", rest: " msg"},
+		{data: "-", rest: ""},
+		{
+			data: `[a@1 x="1"][b@2] msg`,
+			want: []SDElement{{ID: "a@1", Params: map[string]string{"x": "1"}}, {ID: "b@2", Params: map[string]string{}}},
+			rest: " msg",
+		},
+		{
+			data: `[a@1 q="say \"hi\"" b="back\\slash" e="\]" o="\n" u="ünï"]`,
+			want: []SDElement{{ID: "a@1", Params: map[string]string{"q": `say "hi"`, "b": `back\slash`, "e": "]", "o": `\n`, "u": "ünï"}}},
+		},
+		{data: `[a@1 x=""]`, want: []SDElement{{ID: "a@1", Params: map[string]string{"x": ""}}}},
+		{data: "msg", wantErr: true},
+		{data: "", wantErr: true},
+		{data: "[", wantErr: true},
+		{data: "[]", wantErr: true},
+		{data: `[ x="1"]`, wantErr: true},
+		{data: `[a@1`, wantErr: true},
+		{data: `[a@1 x="1"`, wantErr: true},
+		{data: `[a@1 x="1`, wantErr: true},
+		{data: `[a@1 x=1] y="2"]`, wantErr: true},
+		{data: `[a@1 ="1"]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, rest, err := parseStructuredData([]byte(tt.data))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseStructuredData(%q) = %+v, want error", tt.data, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseStructuredData(%q): %v", tt.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) || string(rest) != tt.rest {
+			t.Errorf("parseStructuredData(%q) = %+v, %q, want %+v, %q", tt.data, got, rest, tt.want, tt.rest)
+		}
+	}
+}
+
+func TestFacilityName(t *testing.T) {
+	// Every code has one name, which parses back to the code
+	for code := 0; code <= 23; code++ {
+		name := FacilityName(code)
+		if parsed, ok := ParseFacility(name); !ok || parsed != code {
+			t.Errorf("ParseFacility(FacilityName(%d) = %q) = %d, %v", code, name, parsed, ok)
+		}
+	}
+	tests := map[int]string{0: "kern", 4: "auth", 10: "authpriv", 13: "security", 14: "console", 16: "local0", 23: "local7", 24: "24", -1: "-1"}
+	for code, want := range tests {
+		if got := FacilityName(code); got != want {
+			t.Errorf("FacilityName(%d) = %q, want %q", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSFiles configures the TLS syslog listener (RFC 5425)
+type TLSFiles struct {
+	CertFile       string        // PEM server certificate chain
+	KeyFile        string        // PEM server private key
+	ClientCAFile   string        // PEM client CA bundle; enables mutual TLS when set
+	AllowedClients []string      // Glob patterns matched against client CN and SANs
+	ReloadInterval time.Duration // How often certificate files are checked for changes
+}
+
+// CertReloader serves the current server certificate and client CA pool,
+// reloading them from disk when the files change
+type CertReloader struct {
+	files     TLSFiles
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+	lastCheck time.Time
+}
+
+// NewCertReloader loads the certificate files, failing if they are unusable
+func NewCertReloader(files TLSFiles) (*CertReloader, error) {
+	for _, pattern := range files.AllowedClients {
+		if _, err := matchIdentity(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid allowed client pattern %q: %w", pattern, err)
+		}
+	}
+	r := &CertReloader{files: files}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertReloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, name := range []string{r.files.CertFile, r.files.KeyFile, r.files.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", name, err)
+		}
+		modTimes[name] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.files.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.files.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file %s", r.files.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	r.lastCheck = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+// maybeReload reloads the files if the reload interval has passed and any file changed.
+// A failed reload keeps serving the previous certificate.
+func (r *CertReloader) maybeReload() {
+	r.mu.RLock()
+	due := r.files.ReloadInterval > 0 && time.Since(r.lastCheck) >= r.files.ReloadInterval
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+
+	changed := false
+	r.mu.Lock()
+	r.lastCheck = time.Now()
+	for name, modTime := range r.modTimes {
+		if info, err := os.Stat(name); err == nil && !info.ModTime().Equal(modTime) {
+			changed = true
+		}
+	}
+	r.mu.Unlock()
+
+	if changed {
+		if err := r.load(); err != nil {
+			log.Printf("TLS certificate reload failed, keeping previous certificate: %v", err)
+			return
+		}
+		log.Printf("Reloaded TLS certificates from %s", r.files.CertFile)
+	}
+}
+
+// TLSConfig returns a server configuration that picks up reloaded certificates per handshake
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.maybeReload()
+
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+			}
+			if r.clientCAs != nil {
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+				config.ClientCAs = r.clientCAs
+				config.VerifyConnection = r.verifyClient
+			}
+			return config, nil
+		},
+	}
+}
+
+// verifyClient enforces the allowed client CN/SAN patterns
+func (r *CertReloader) verifyClient(state tls.ConnectionState) error {
+	if len(r.files.AllowedClients) == 0 {
+		return nil
+	}
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("client certificate required")
+	}
+	if _, ok := matchClientIdentity(state.PeerCertificates[0], r.files.AllowedClients); !ok {
+		return fmt.Errorf("client certificate %q is not in the allowed clients list", state.PeerCertificates[0].Subject.CommonName)
+	}
+	return nil
+}
+
+// matchClientIdentity returns the first CN or SAN of the certificate matching any pattern
+func matchClientIdentity(cert *x509.Certificate, patterns []string) (string, bool) {
+	for _, identity := range certIdentities(cert) {
+		for _, pattern := range patterns {
+			if ok, _ := matchIdentity(pattern, identity); ok {
+				return identity, true
+			}
+		}
+	}
+	return "", false
+}
+
+// matchIdentity reports whether a CN or SAN matches a glob pattern with path.Match
+// syntax, except that * and ? also match "/" so that patterns like
+// "spiffe://example.org/*" cover whole URI SANs. An identity holding a NUL byte,
+// which stands in for "/" while matching, never matches.
+func matchIdentity(pattern, identity string) (bool, error) {
+	if strings.IndexByte(identity, 0) >= 0 {
+		return false, nil
+	}
+	return path.Match(strings.ReplaceAll(pattern, "/", "\x00"), strings.ReplaceAll(identity, "/", "\x00"))
+}
+
+// certIdentities lists the subject CN followed by DNS, email and URI SANs
+func certIdentities(cert *x509.Certificate) []string {
+	var identities []string
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	identities = append(identities, cert.DNSNames...)
+	identities = append(identities, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	return identities
+}
+
+// tlsClientMetadata describes the authenticated client for the envelope metadata
+func tlsClientMetadata(state tls.ConnectionState, patterns []string) Metadata {
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	cert := state.PeerCertificates[0]
+
+	identity, ok := matchClientIdentity(cert, patterns)
+	if !ok {
+		identities := certIdentities(cert)
+		if len(identities) > 0 {
+			identity = identities[0]
+		}
+	}
+
+	fingerprint := sha256.Sum256(cert.Raw)
+	return Metadata{
+		"tls_client":      identity,
+		"tls_fingerprint": hex.EncodeToString(fingerprint[:]),
+	}
+}
+
+// splitList splits a comma-separated environment value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatchClientIdentity(t *testing.T) {
+	uri, err := url.Parse("spiffe://example.org/ns/prod/sa/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "db-primary"},
+		DNSNames:       []string{"db1.db.example.com"},
+		EmailAddresses: []string{"dba@example.com"},
+		URIs:           []*url.URL{uri},
+	}
+	tests := []struct {
+		patterns []string
+		want     string // Matched identity, empty for no match
+	}{
+		{[]string{"db-*"}, "db-primary"},
+		{[]string{"*.db.example.com"}, "db1.db.example.com"},
+		{[]string{"*@example.com"}, "dba@example.com"},
+		{[]string{"*.web.example.com", "dba@*"}, "dba@example.com"},
+
+		// The CN is tried before the SANs, whatever the pattern order
+		{[]string{"*.example.com", "db-primary"}, "db-primary"},
+
+		// * spans the path segments of URI SANs
+		{[]string{"spiffe://example.org/*"}, "spiffe://example.org/ns/prod/sa/db"},
+		{[]string{"spiffe://example.org/ns/prod/*"}, "spiffe://example.org/ns/prod/sa/db"},
+		{[]string{"*"}, "db-primary"},
+		{[]string{"spiffe://example.org/ns/dev/*"}, ""},
+		{[]string{"spiffe://other.org/*"}, ""},
+
+		{[]string{"web-*", "*.web.example.com"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		got, ok := matchClientIdentity(cert, tt.patterns)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("matchClientIdentity(%q) = %q, %v, want %q", tt.patterns, got, ok, tt.want)
+		}
+	}
+
+	if _, err := NewCertReloader(TLSFiles{AllowedClients: []string{"db-["}}); err == nil {
+		t.Error("NewCertReloader accepted an invalid allowed client pattern")
+	}
+}
+
+// testCA issues certificates for TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue signs a leaf certificate for template, returning its PEM certificate and key
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// clientConfig returns a client configuration presenting a certificate issued for template
+func (ca *testCA) clientConfig(t *testing.T, template *x509.Certificate) *tls.Config {
+	t.Helper()
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	cert, err := tls.X509KeyPair(ca.issue(t, template))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	return &tls.Config{RootCAs: roots, ServerName: "localhost", Certificates: []tls.Certificate{cert}}
+}
+
+func TestTLSSyslogServer(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	files := TLSFiles{
+		CertFile:       filepath.Join(dir, "server.crt"),
+		KeyFile:        filepath.Join(dir, "server.key"),
+		ClientCAFile:   filepath.Join(dir, "ca.crt"),
+		AllowedClients: []string{"*.db.example.com"},
+	}
+	certPEM, keyPEM := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "localhost"},
+		DNSNames:    []string{"localhost"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	for name, data := range map[string][]byte{files.CertFile: certPEM, files.KeyFile: keyPEM, files.ClientCAFile: ca.pem} {
+		if err := os.WriteFile(name, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reloader, err := NewCertReloader(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router, path := testRouter(t)
+	source := &Source{Name: "tls", SyslogFormat: SyslogFormatAuto}
+	server := NewTLSSyslogServer("", NewPipeline(router, 0, 0), source, StreamConfig{Framing: FramingAuto, Delimiter: '\n', MaxFrameSize: 1024}, reloader)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveStream(t, server, listener)
+
+	send := func(config *tls.Config, message string) error {
+		conn, err := tls.Dial("tcp", listener.Addr().String(), config)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if _, err := io.WriteString(conn, message); err != nil {
+			return err
+		}
+		// A rejected client learns of it from the server's alert, after the handshake
+		// completed on its side with TLS 1.3
+		conn.CloseWrite()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+
+	// Clients outside the allow-list and clients without a certificate are rejected
+	if err := send(ca.clientConfig(t, &x509.Certificate{Subject: pkix.Name{CommonName: "web1.web.example.com"}}), "rejected\n"); err == nil {
+		t.Error("client outside the allow-list was accepted")
+	}
+	noCert := ca.clientConfig(t, &x509.Certificate{})
+	noCert.Certificates = nil
+	if err := send(noCert, "anonymous\n"); err == nil {
+		t.Error("client without a certificate was accepted")
+	}
+
+	// The allowed identity is recorded, even when the CN does not match
+	client := &x509.Certificate{Subject: pkix.Name{CommonName: "db1"}, DNSNames: []string{"db1.db.example.com"}}
+	clientConfig := ca.clientConfig(t, client)
+	if err := send(clientConfig, "<134>Oct 18 10:00:00 db1 mysqld: started\n"); err != nil {
+		t.Fatal(err)
+	}
+	records := waitRecords(t, router, path, 1)
+	if len(records) != 1 || records[0].Message != "<134>Oct 18 10:00:00 db1 mysqld: started" {
+		t.Fatalf("records = %+v, want only the allowed client's message", records)
+	}
+	if got := records[0].Metadata["tls_client"]; got != "db1.db.example.com" {
+		t.Errorf("tls_client = %q, want db1.db.example.com", got)
+	}
+	if len(records[0].Metadata["tls_fingerprint"]) != 64 {
+		t.Errorf("tls_fingerprint = %q, want a SHA-256 hex digest", records[0].Metadata["tls_fingerprint"])
+	}
+}